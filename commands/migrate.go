@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"context"
+	"cotizador-productos-eml/config"
+	"cotizador-productos-eml/db"
+	"fmt"
+	"log/slog"
+
+	"github.com/uptrace/bun"
+)
+
+// Migrate aplica (up), revierte el último grupo (down) o lista (status) las migraciones
+func Migrate(conn *bun.DB, cfg *config.Config, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		group, err := db.Migrate(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if group.IsZero() {
+			slog.Info("No hay migraciones pendientes")
+			return nil
+		}
+		slog.Info("Migraciones aplicadas", "grupo", group.String())
+	case "down":
+		group, err := db.Rollback(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if group.IsZero() {
+			slog.Info("No hay migraciones para revertir")
+			return nil
+		}
+		slog.Info("Migraciones revertidas", "grupo", group.String())
+	case "status":
+		ms, err := db.MigrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			estado := "pendiente"
+			if m.IsApplied() {
+				estado = fmt.Sprintf("aplicada (grupo %d, %s)", m.GroupID, m.MigratedAt.Format("02-01-2006 15:04"))
+			}
+			fmt.Printf("%s_%s\t%s\n", m.Name, m.Comment, estado)
+		}
+	default:
+		return fmt.Errorf("acción de migración desconocida %q, usa up, down o status", action)
+	}
+	return nil
+}
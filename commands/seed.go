@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"cotizador-productos-eml/config"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// seedEmailCliente identifica los datos de demostración para no cargarlos dos veces
+const seedEmailCliente = "cliente.demo@example.com"
+
+// Seed carga productos, usuarios y pedidos de demostración
+func Seed(conn *bun.DB, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	password := fs.String("password", "", "contraseña de los usuarios demo; si se omite se genera una aleatoria")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	exists, err := conn.NewSelect().
+		Model((*models.Usuario)(nil)).
+		WhereAllWithDeleted().
+		Where("email = ?", seedEmailCliente).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("los datos de demostración ya están cargados")
+	}
+
+	comuna, ok := utils.FindComuna("Providencia")
+	if !ok {
+		return errors.New("no se encontró la comuna de los datos de demostración")
+	}
+
+	now := time.Now()
+	productos := []*models.Producto{
+		{Nombre: "Resma papel carta 500 hojas", PrecioVenta: 4990, PrecioCompra: 3200},
+		{Nombre: "Tóner HP 85A", PrecioVenta: 45990, PrecioCompra: 31000},
+		{Nombre: "Archivador lomo ancho", PrecioVenta: 2490, PrecioCompra: 1400},
+		{Nombre: "Caja lápices pasta azul x50", PrecioVenta: 8990, PrecioCompra: 5500},
+		{Nombre: "Corchetera metálica", PrecioVenta: 6990, PrecioCompra: 4100},
+		{Nombre: "Cinta de embalaje transparente", PrecioVenta: 1290, PrecioCompra: 700},
+	}
+	for _, p := range productos {
+		p.Disponible = true
+		p.UltimaVezIngresado = now
+		p.CreatedAt = now
+		p.UpdatedAt = now
+	}
+
+	usuarios := []*models.Usuario{
+		{Nombre: "Cliente", Apellido: "Demo", Email: seedEmailCliente, Rol: utils.RolCliente},
+		{Nombre: "Vendedor", Apellido: "Demo", Email: "vendedor.demo@example.com", Rol: utils.RolVendedor},
+		{Nombre: "Bodega", Apellido: "Demo", Email: "bodega.demo@example.com", Rol: utils.RolBodega},
+		{Nombre: "Contabilidad", Apellido: "Demo", Email: "contabilidad.demo@example.com", Rol: utils.RolContabilidad},
+	}
+	generada := *password == ""
+	if generada {
+		if *password, err = generatePassword(usuarios[0]); err != nil {
+			return err
+		}
+	}
+	for _, u := range usuarios {
+		if u.Password, err = hashPassword(*password, u); err != nil {
+			return err
+		}
+		u.Ciudad = comuna.Nombre
+		u.RegionCodigo = comuna.RegionCodigo
+		u.ComunaCodigo = comuna.Codigo
+		u.Celular = "+56912345678"
+		u.Verificado = true
+		u.CreatedAt = now
+		u.UpdatedAt = now
+	}
+
+	// Cantidades por producto de cada pedido del cliente demo
+	type item struct{ producto, cantidad int }
+	pedidos := [][]item{
+		{{0, 10}, {2, 5}, {5, 12}},
+		{{1, 2}, {3, 1}, {4, 3}},
+	}
+
+	err = conn.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&productos).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(&usuarios).Exec(ctx); err != nil {
+			return err
+		}
+
+		for _, items := range pedidos {
+			pedido := &models.Pedido{
+				UsuarioId:        usuarios[0].ID,
+				Estado:           "pendiente",
+				CiudadDestino:    comuna.Nombre,
+				RegionDestino:    comuna.RegionCodigo,
+				ComunaDestino:    comuna.Codigo,
+				DireccionDestino: "Av. Providencia 1234, oficina 56",
+				RutDestinatario:  "11111111-1",
+				TelefonoDestino:  "+56912345678",
+				Company:          "Starken",
+				TipoEnvio:        "estandar",
+				MetodoPago:       "transferencia",
+				TipoDocumento:    "boleta",
+				CreatedAt:        now,
+				UpdatedAt:        now,
+			}
+			detalles := make([]*models.DetallePedido, 0, len(items))
+			for _, it := range items {
+				producto, cantidad := productos[it.producto], it.cantidad
+				detalles = append(detalles, &models.DetallePedido{
+					ProductoID:     producto.ID,
+					NombreProducto: producto.Nombre,
+					Cantidad:       cantidad,
+					PrecioUnitario: producto.PrecioVenta,
+					PrecioTotal:    producto.PrecioVenta * cantidad,
+					CreatedAt:      now,
+					UpdatedAt:      now,
+				})
+				pedido.Total += producto.PrecioVenta * cantidad
+			}
+
+			if _, err := tx.NewInsert().Model(pedido).Exec(ctx); err != nil {
+				return err
+			}
+			for _, d := range detalles {
+				d.PedidoID = pedido.ID
+			}
+			if _, err := tx.NewInsert().Model(&detalles).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Datos de demostración cargados: %d productos, %d usuarios y %d pedidos\n", len(productos), len(usuarios), len(pedidos))
+	for _, u := range usuarios {
+		fmt.Printf("  %s (%s)\n", u.Email, u.Rol)
+	}
+	if generada {
+		fmt.Printf("Contraseña de los usuarios demo: %s\n", *password)
+	}
+	return nil
+}
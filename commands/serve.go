@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"cotizador-productos-eml/config"
+	"cotizador-productos-eml/routes"
+	"cotizador-productos-eml/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunotel"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Serve inicia el servidor HTTP de la API
+func Serve(conn *bun.DB, cfg *config.Config, args []string) error {
+	// Los secretos y URLs se validan antes de aceptar conexiones
+	if err := cfg.ValidateServer(); err != nil {
+		return fmt.Errorf("configuración inválida:\n%w", err)
+	}
+
+	// Cargar las claves de firma de los JWT; se pasan a los handlers y middlewares junto con el envío de correos
+	keys, err := utils.LoadJWTKeys(cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("error al cargar las claves JWT: %w", err)
+	}
+	mailer := utils.NewMailer(cfg.Email)
+
+	// Trazas de OpenTelemetry; las pendientes se envían al apagar el servidor
+	shutdownTracing, err := utils.SetupTracing(context.Background(), cfg.Tracing, cfg.Environment)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error enviando las trazas pendientes", "error", err)
+		}
+	}()
+	if cfg.Tracing.Enabled {
+		// Cada consulta SQL queda como un span hijo del span de la petición
+		conn.AddQueryHook(bunotel.NewQueryHook(bunotel.WithDBName("cotizador")))
+	}
+
+	// Las migraciones pendientes se aplican al iniciar salvo que MIGRATE_ON_START=false
+	if cfg.MigrateOnStart {
+		if err := Migrate(conn, cfg, []string{"up"}); err != nil {
+			return fmt.Errorf("error al ejecutar migraciones: %w", err)
+		}
+	}
+
+	// Configuración del router de Gin. El logger y la recuperación de gin se reemplazan por los de slog
+	if !cfg.IsDevelopment() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	// Los handlers pasan c como contexto a bun y a los correos; con ContextWithFallback c expone el contexto
+	// de la petición (span activo, cancelación) para que las consultas queden dentro de la traza
+	r.ContextWithFallback = true
+	r.Use(utils.RequestIDMiddleware())
+	if cfg.Tracing.Enabled {
+		r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(tracedRequest)))
+	}
+	r.Use(utils.RequestLogger(), utils.RecoveryMiddleware())
+	if cfg.Metrics.Enabled {
+		utils.RegisterDBMetrics(conn)
+		r.Use(utils.MetricsMiddleware())
+	}
+
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.CORSOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With", "X-CSRF-Token", "X-API-Key", "X-Request-ID", "traceparent", "tracestate", "Access-Control-Allow-Origin", "Cookie", "Set-Cookie"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "Content-Type", "Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Set-Cookie", "Cookie"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	// Registrar rutas
+	routes.RegisterProductoRoutes(r, conn, keys)
+	routes.AuthRoutes(r, conn, cfg, keys, mailer)
+	routes.UserRoutes(r, conn, keys, mailer)
+	routes.OrderRoutes(r, conn, keys)
+	routes.RoleRoutes(r, conn, keys)
+	routes.WellKnownRoutes(r, keys)
+	routes.GeoRoutes(r)
+
+	routes.HealthRoutes(r, conn)
+	routes.MetricsRoutes(r, cfg)
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// SIGINT/SIGTERM inician el apagado; main cierra la base de datos cuando Serve retorna
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Iniciar el servidor
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Servidor escuchando", "addr", srv.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("error al iniciar el servidor: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Dejar de aceptar conexiones y esperar a que terminen las solicitudes en curso
+	slog.Info("Apagando el servidor, esperando las solicitudes en curso", "timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error al apagar el servidor: %w", err)
+	}
+	slog.Info("Servidor detenido")
+	return nil
+}
+
+// tracedRequest excluye de las trazas las sondas de salud y el scrape de métricas
+func tracedRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"context"
+	"cotizador-productos-eml/config"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateAdmin crea un usuario administrador verificado. Si el email ya existe, el usuario pasa a ser administrador
+func CreateAdmin(conn *bun.DB, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email del administrador (requerido)")
+	nombre := fs.String("nombre", "Administrador", "nombre")
+	apellido := fs.String("apellido", "", "apellido")
+	password := fs.String("password", "", "contraseña; si se omite se genera una aleatoria")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	*email = utils.NormalizeEmail(*email)
+	if *email == "" {
+		return errors.New("el email es requerido (-email)")
+	}
+
+	ctx := context.Background()
+	usuario := new(models.Usuario)
+	err := conn.NewSelect().Model(usuario).Where("email = ?", *email).Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// Un usuario existente solo cambia de rol; su contraseña se mantiene salvo que se indique otra
+	if err == nil {
+		query := conn.NewUpdate().
+			Model((*models.Usuario)(nil)).
+			Set("rol = ?", utils.RolAdmin).
+			Set("verificado = true").
+			Set("updated_at = ?", time.Now()).
+			Where("id = ?", usuario.ID)
+		if *password != "" {
+			hash, err := hashPassword(*password, usuario)
+			if err != nil {
+				return err
+			}
+			query = query.Set("password = ?", hash)
+		}
+		if _, err := query.Exec(ctx); err != nil {
+			return err
+		}
+		fmt.Printf("El usuario %s (id %d) ahora es administrador\n", usuario.Email, usuario.ID)
+		return nil
+	}
+
+	usuario = &models.Usuario{
+		Nombre:     *nombre,
+		Apellido:   *apellido,
+		Email:      *email,
+		Rol:        utils.RolAdmin,
+		Verificado: true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	generada := *password == ""
+	if generada {
+		if *password, err = generatePassword(usuario); err != nil {
+			return err
+		}
+	}
+	if usuario.Password, err = hashPassword(*password, usuario); err != nil {
+		return err
+	}
+	if _, err := conn.NewInsert().Model(usuario).Exec(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Administrador %s creado (id %d)\n", usuario.Email, usuario.ID)
+	if generada {
+		fmt.Printf("Contraseña generada: %s\n", *password)
+	}
+	return nil
+}
+
+// ResetPassword asigna una contraseña nueva a un usuario
+func ResetPassword(conn *bun.DB, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	email := fs.String("email", "", "email del usuario (requerido)")
+	password := fs.String("password", "", "contraseña nueva; si se omite se genera una aleatoria")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	*email = utils.NormalizeEmail(*email)
+	if *email == "" {
+		return errors.New("el email es requerido (-email)")
+	}
+
+	ctx := context.Background()
+	usuario := new(models.Usuario)
+	if err := conn.NewSelect().Model(usuario).Where("email = ?", *email).Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no existe un usuario con el email %s", *email)
+		}
+		return err
+	}
+
+	var err error
+	generada := *password == ""
+	if generada {
+		if *password, err = generatePassword(usuario); err != nil {
+			return err
+		}
+	}
+	hash, err := hashPassword(*password, usuario)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		Set("password = ?", hash).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", usuario.ID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Contraseña de %s actualizada\n", usuario.Email)
+	if generada {
+		fmt.Printf("Contraseña generada: %s\n", *password)
+	}
+	return nil
+}
+
+// hashPassword valida la contraseña con la misma política de la API y devuelve su hash bcrypt
+func hashPassword(password string, usuario *models.Usuario) (string, error) {
+	if errs := utils.ValidatePassword(password, utils.PasswordUser{Email: usuario.Email, Nombre: usuario.Nombre, Apellido: usuario.Apellido}); len(errs) > 0 {
+		mensajes := make([]string, 0, len(errs))
+		for _, e := range errs {
+			mensajes = append(mensajes, e.Message)
+		}
+		return "", fmt.Errorf("la contraseña no cumple la política de seguridad: %s", strings.Join(mensajes, "; "))
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// generatePassword genera una contraseña aleatoria que cumple la política de contraseñas
+func generatePassword(usuario *models.Usuario) (string, error) {
+	for {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		password := base64.RawURLEncoding.EncodeToString(b)
+		if len(utils.ValidatePassword(password, utils.PasswordUser{Email: usuario.Email, Nombre: usuario.Nombre, Apellido: usuario.Apellido})) == 0 {
+			return password, nil
+		}
+	}
+}
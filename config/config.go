@@ -0,0 +1,336 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// minJWTSecretLen es el largo mínimo de JWT_SECRET (256 bits para HS256)
+	minJWTSecretLen = 32
+
+	// minMetricsTokenLen es el largo mínimo de METRICS_TOKEN
+	minMetricsTokenLen = 16
+)
+
+// Config agrupa la configuración de la aplicación. Se carga una sola vez en main.go
+type Config struct {
+	Environment    string
+	DatabaseURL    string
+	FrontendURL    string
+	CORSOrigins    []string
+	CookieDomain   string
+	MigrateOnStart bool
+	LogLevel       slog.Level
+	Server         ServerConfig
+	Metrics        MetricsConfig
+	Tracing        TracingConfig
+	JWT            JWTConfig
+	Email          EmailConfig
+	MFA            MFAConfig
+}
+
+// ServerConfig define el puerto y los tiempos límite del servidor HTTP
+type ServerConfig struct {
+	Port            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// MetricsConfig habilita /metrics; si Token no está vacío se exige como Bearer
+type MetricsConfig struct {
+	Enabled bool
+	Token   string
+}
+
+// TracingConfig controla el envío de trazas de OpenTelemetry. El destino del exportador OTLP/HTTP se
+// configura con las variables estándar OTEL_EXPORTER_OTLP_ENDPOINT u OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+type TracingConfig struct {
+	Enabled     bool
+	ServiceName string
+	SampleRatio float64
+}
+
+// JWTConfig define las claves de firma y la duración de los tokens de sesión.
+// Con claves asimétricas, los tokens HS256 firmados con Secret solo se aceptan hasta LegacyHS256Until.
+// Issuer va en el claim "iss" de todos los tokens y Audience en el "aud" de los access tokens
+type JWTConfig struct {
+	Secret           string
+	KeysDir          string
+	SigningKID       string
+	Issuer           string
+	Audience         string
+	LegacyHS256Until time.Time
+	AccessTTL        time.Duration
+	RefreshTTL       time.Duration
+}
+
+// EmailConfig define la cuenta de Brevo y el remitente de los correos
+type EmailConfig struct {
+	BrevoAPIKey string
+	SenderName  string
+	SenderEmail string
+	FrontendURL string
+}
+
+// MFAConfig define el comportamiento de la autenticación de dos factores
+type MFAConfig struct {
+	Issuer           string
+	RequiredForAdmin bool
+}
+
+// Load lee la configuración desde las variables de entorno y aplica los valores por defecto.
+// Solo valida lo que necesitan todos los comandos; el servidor además llama a ValidateServer
+func Load() (*Config, error) {
+	var errs []error
+
+	cfg := &Config{
+		Environment:  getEnv("ENVIRONMENT", EnvProduction),
+		DatabaseURL:  os.Getenv("DATABASE_PUBLIC_URL"),
+		FrontendURL:  strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/"),
+		CookieDomain: os.Getenv("COOKIE_DOMAIN"),
+		Server: ServerConfig{
+			Port: getEnv("PORT", "8000"),
+		},
+		Metrics: MetricsConfig{
+			Token: os.Getenv("METRICS_TOKEN"),
+		},
+		Tracing: TracingConfig{
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "cotizador-productos-eml"),
+		},
+		JWT: JWTConfig{
+			Secret:     os.Getenv("JWT_SECRET"),
+			KeysDir:    os.Getenv("JWT_KEYS_DIR"),
+			SigningKID: os.Getenv("JWT_SIGNING_KID"),
+			Issuer:     getEnv("JWT_ISSUER", "cotizador-productos-eml"),
+			Audience:   getEnv("JWT_AUDIENCE", "cotizador-productos-eml-api"),
+		},
+		Email: EmailConfig{
+			BrevoAPIKey: os.Getenv("BREVO_API_KEY"),
+			SenderName:  getEnv("EMAIL_SENDER_NAME", "Cotizador Productos EML"),
+			SenderEmail: getEnv("EMAIL_SENDER", "pipe12.fm@gmail.com"),
+		},
+		MFA: MFAConfig{
+			Issuer: getEnv("MFA_ISSUER", "Cotizador EML"),
+		},
+	}
+	cfg.Email.FrontendURL = cfg.FrontendURL
+
+	if cfg.Environment != EnvDevelopment && cfg.Environment != EnvProduction {
+		errs = append(errs, fmt.Errorf("ENVIRONMENT debe ser %q o %q", EnvDevelopment, EnvProduction))
+	}
+	if cfg.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_PUBLIC_URL es requerida"))
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		errs = append(errs, errors.New("LOG_LEVEL debe ser debug, info, warn o error"))
+	}
+
+	var err error
+	if cfg.MigrateOnStart, err = getBool("MIGRATE_ON_START", true); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Metrics.Enabled, err = getBool("METRICS_ENABLED", false); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Tracing.Enabled, err = getBool("TRACING_ENABLED", false); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Tracing.SampleRatio, err = getFloat("TRACING_SAMPLE_RATIO", 1); err != nil {
+		errs = append(errs, err)
+	} else if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO debe estar entre 0 y 1"))
+	}
+	if cfg.MFA.RequiredForAdmin, err = getBool("MFA_REQUIRED_FOR_ADMIN", false); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Server.ReadTimeout, err = getDuration("HTTP_READ_TIMEOUT", 15*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Server.WriteTimeout, err = getDuration("HTTP_WRITE_TIMEOUT", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Server.IdleTimeout, err = getDuration("HTTP_IDLE_TIMEOUT", 60*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Server.ShutdownTimeout, err = getDuration("SHUTDOWN_TIMEOUT", 20*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.JWT.AccessTTL, err = getDuration("ACCESS_TOKEN_TTL", 15*time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.JWT.RefreshTTL, err = getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.JWT.LegacyHS256Until, err = getTime("JWT_LEGACY_HS256_UNTIL"); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Por defecto solo se permite el origen del frontend
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+				cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+			}
+		}
+	} else if cfg.FrontendURL != "" {
+		cfg.CORSOrigins = []string{cfg.FrontendURL}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ValidateServer verifica la configuración que necesita la API: puerto, secretos, URLs y duración de los tokens
+func (c *Config) ValidateServer() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, errors.New("PORT debe ser un número entre 1 y 65535"))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT, HTTP_IDLE_TIMEOUT y SHUTDOWN_TIMEOUT deben ser positivos"))
+	}
+
+	if c.JWT.KeysDir == "" && c.JWT.Secret == "" {
+		errs = append(errs, errors.New("JWT_SECRET o JWT_KEYS_DIR debe estar configurado"))
+	}
+	// Un secreto débil permitiría falsificar tokens HS256 aunque se firme con claves asimétricas
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < minJWTSecretLen {
+		errs = append(errs, fmt.Errorf("JWT_SECRET debe tener al menos %d caracteres", minJWTSecretLen))
+	}
+	if c.JWT.KeysDir != "" && c.JWT.SigningKID == "" {
+		errs = append(errs, errors.New("JWT_SIGNING_KID es requerido cuando se usa JWT_KEYS_DIR"))
+	}
+	if !c.JWT.LegacyHS256Until.IsZero() && (c.JWT.KeysDir == "" || c.JWT.Secret == "") {
+		errs = append(errs, errors.New("JWT_LEGACY_HS256_UNTIL requiere JWT_KEYS_DIR y JWT_SECRET"))
+	}
+	// Los tokens internos usan el emisor como audiencia; si coincidiera con JWT_AUDIENCE pasarían por access tokens
+	if c.JWT.Issuer == c.JWT.Audience {
+		errs = append(errs, errors.New("JWT_ISSUER y JWT_AUDIENCE deben ser distintos"))
+	}
+	if c.JWT.AccessTTL <= 0 || c.JWT.RefreshTTL <= 0 {
+		errs = append(errs, errors.New("ACCESS_TOKEN_TTL y REFRESH_TOKEN_TTL deben ser positivos"))
+	} else if c.JWT.AccessTTL >= c.JWT.RefreshTTL {
+		errs = append(errs, errors.New("ACCESS_TOKEN_TTL debe ser menor que REFRESH_TOKEN_TTL"))
+	}
+
+	if c.FrontendURL == "" {
+		errs = append(errs, errors.New("FRONTEND_URL es requerida"))
+	} else if _, err := parseHTTPURL(c.FrontendURL); err != nil {
+		errs = append(errs, fmt.Errorf("FRONTEND_URL: %w", err))
+	}
+	for _, origin := range c.CORSOrigins {
+		if err := validateOrigin(origin); err != nil {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err))
+		}
+	}
+
+	if c.Metrics.Token != "" && len(c.Metrics.Token) < minMetricsTokenLen {
+		errs = append(errs, fmt.Errorf("METRICS_TOKEN debe tener al menos %d caracteres", minMetricsTokenLen))
+	}
+
+	if !c.IsDevelopment() && c.Email.BrevoAPIKey == "" {
+		errs = append(errs, errors.New("BREVO_API_KEY es requerida fuera de development"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// IsDevelopment indica si la aplicación corre en desarrollo (cookies sin Secure, BREVO_API_KEY opcional)
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == EnvDevelopment
+}
+
+// parseHTTPURL verifica que el valor sea una URL http(s) absoluta
+func parseHTTPURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q no es una URL http(s) válida", value)
+	}
+	return u, nil
+}
+
+// validateOrigin verifica que el valor sea un origen CORS: esquema y host, sin ruta
+func validateOrigin(value string) error {
+	u, err := parseHTTPURL(value)
+	if err != nil {
+		return err
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q no debe incluir ruta ni parámetros", value)
+	}
+	return nil
+}
+
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func getBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s debe ser true o false", key)
+	}
+	return b, nil
+}
+
+func getFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s debe ser un número", key)
+	}
+	return f, nil
+}
+
+// getTime lee una fecha RFC 3339 (2025-07-01T00:00:00Z) o solo la fecha (2025-07-01, en UTC). Vacía devuelve la fecha cero
+func getTime(key string) (time.Time, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s debe ser una fecha RFC 3339 (por ejemplo 2025-07-01T00:00:00Z) o AAAA-MM-DD", key)
+	}
+	return t, nil
+}
+
+func getDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s debe ser una duración válida (por ejemplo 15m o 168h)", key)
+	}
+	return d, nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validServerConfig devuelve una configuración que supera ValidateServer
+func validServerConfig() *Config {
+	return &Config{
+		Environment: EnvProduction,
+		FrontendURL: "https://app.example.com",
+		CORSOrigins: []string{"https://app.example.com"},
+		Server: ServerConfig{
+			Port:            "8000",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		JWT: JWTConfig{
+			Secret:     strings.Repeat("s", minJWTSecretLen),
+			Issuer:     "cotizador-productos-eml",
+			Audience:   "cotizador-productos-eml-api",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 7 * 24 * time.Hour,
+		},
+		Email: EmailConfig{BrevoAPIKey: "xkeysib-test"},
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	if err := validServerConfig().ValidateServer(); err != nil {
+		t.Fatalf("ValidateServer rechazó una configuración válida: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string // fragmento esperado en el error; vacío si la configuración es válida
+	}{
+		{"JWT_SECRET corto", func(c *Config) { c.JWT.Secret = strings.Repeat("s", minJWTSecretLen-1) }, "JWT_SECRET debe tener al menos"},
+		{"sin JWT_SECRET ni claves", func(c *Config) { c.JWT.Secret = "" }, "JWT_SECRET o JWT_KEYS_DIR"},
+		{"claves sin JWT_SIGNING_KID", func(c *Config) { c.JWT.KeysDir = "/keys" }, "JWT_SIGNING_KID es requerido"},
+		{"claves sin JWT_SECRET", func(c *Config) { c.JWT.Secret, c.JWT.KeysDir, c.JWT.SigningKID = "", "/keys", "2025-06" }, ""},
+		{"migración HS256 sin claves", func(c *Config) { c.JWT.LegacyHS256Until = time.Now() }, "JWT_LEGACY_HS256_UNTIL requiere"},
+		{"emisor igual a la audiencia", func(c *Config) { c.JWT.Audience = c.JWT.Issuer }, "JWT_ISSUER y JWT_AUDIENCE"},
+		{"access TTL igual al refresh TTL", func(c *Config) { c.JWT.AccessTTL = c.JWT.RefreshTTL }, "ACCESS_TOKEN_TTL debe ser menor"},
+		{"access TTL mayor al refresh TTL", func(c *Config) { c.JWT.AccessTTL = c.JWT.RefreshTTL + time.Hour }, "ACCESS_TOKEN_TTL debe ser menor"},
+		{"TTL negativo", func(c *Config) { c.JWT.AccessTTL = -time.Minute }, "deben ser positivos"},
+		{"origen CORS con ruta", func(c *Config) { c.CORSOrigins = []string{"https://app.example.com/login"} }, "CORS_ALLOWED_ORIGINS"},
+		{"origen CORS sin esquema", func(c *Config) { c.CORSOrigins = []string{"app.example.com"} }, "CORS_ALLOWED_ORIGINS"},
+		{"origen CORS con otro esquema", func(c *Config) { c.CORSOrigins = []string{"ftp://app.example.com"} }, "CORS_ALLOWED_ORIGINS"},
+		{"origen CORS con puerto", func(c *Config) { c.CORSOrigins = []string{"http://localhost:3000"} }, ""},
+		{"sin FRONTEND_URL", func(c *Config) { c.FrontendURL = "" }, "FRONTEND_URL es requerida"},
+		{"FRONTEND_URL inválida", func(c *Config) { c.FrontendURL = "app.example.com" }, "FRONTEND_URL"},
+		{"puerto inválido", func(c *Config) { c.Server.Port = "70000" }, "PORT debe ser"},
+		{"timeout en cero", func(c *Config) { c.Server.ShutdownTimeout = 0 }, "SHUTDOWN_TIMEOUT"},
+		{"METRICS_TOKEN corto", func(c *Config) { c.Metrics.Token = "corto" }, "METRICS_TOKEN debe tener"},
+		{"sin BREVO_API_KEY en producción", func(c *Config) { c.Email.BrevoAPIKey = "" }, "BREVO_API_KEY es requerida"},
+		{"sin BREVO_API_KEY en desarrollo", func(c *Config) { c.Email.BrevoAPIKey, c.Environment = "", EnvDevelopment }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServerConfig()
+			tt.modify(cfg)
+			err := cfg.ValidateServer()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("ValidateServer() = %v, se esperaba nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateServer() = %v, se esperaba un error con %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateServerReportsAllErrors(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.JWT.Secret = "corto"
+	cfg.CORSOrigins = []string{"https://app.example.com/"}
+	cfg.JWT.AccessTTL = cfg.JWT.RefreshTTL
+
+	err := cfg.ValidateServer()
+	if err == nil {
+		t.Fatal("ValidateServer() = nil, se esperaban errores")
+	}
+	for _, want := range []string{"JWT_SECRET", "CORS_ALLOWED_ORIGINS", "ACCESS_TOKEN_TTL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("el error %q no menciona %s", err, want)
+		}
+	}
+}
+
+func TestLoadCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name     string
+		origins  string
+		frontend string
+		want     []string
+	}{
+		{"por defecto el frontend", "", "https://app.example.com/", []string{"https://app.example.com"}},
+		{"lista con espacios y barras", " https://a.example.com/ ,https://b.example.com,,", "https://app.example.com", []string{"https://a.example.com", "https://b.example.com"}},
+		{"sin frontend ni orígenes", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_PUBLIC_URL", "postgres://localhost/cotizador")
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			t.Setenv("FRONTEND_URL", tt.frontend)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if strings.Join(cfg.CORSOrigins, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("CORSOrigins = %v, se esperaba %v", cfg.CORSOrigins, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"cotizador-productos-eml/db/migrations"
+	"fmt"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+// newMigrator crea el migrador con las migraciones embebidas en db/migrations.
+// Las aplicadas se registran en la tabla bun_migrations
+func newMigrator(ctx context.Context, db *bun.DB) (*migrate.Migrator, error) {
+	migrator := migrate.NewMigrator(db, migrations.Migrations, migrate.WithMarkAppliedOnSuccess(true))
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("error creando las tablas de migraciones: %w", err)
+	}
+	return migrator, nil
+}
+
+// Migrate aplica las migraciones pendientes. El bloqueo evita que dos instancias migren a la vez
+func Migrate(ctx context.Context, db *bun.DB) (*migrate.MigrationGroup, error) {
+	migrator, err := newMigrator(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	return migrator.Migrate(ctx)
+}
+
+// Rollback revierte el último grupo de migraciones aplicado
+func Rollback(ctx context.Context, db *bun.DB) (*migrate.MigrationGroup, error) {
+	migrator, err := newMigrator(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	return migrator.Rollback(ctx)
+}
+
+// MigrationStatus devuelve todas las migraciones conocidas indicando cuáles están aplicadas
+func MigrationStatus(ctx context.Context, db *bun.DB) (migrate.MigrationSlice, error) {
+	migrator, err := newMigrator(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.MigrationsWithStatus(ctx)
+}
+
+// PendingMigrations devuelve las migraciones sin aplicar. A diferencia de MigrationStatus no crea
+// las tablas de migraciones, por lo que falla si la base nunca fue migrada
+func PendingMigrations(ctx context.Context, db *bun.DB) (migrate.MigrationSlice, error) {
+	ms, err := migrate.NewMigrator(db, migrations.Migrations).MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ms.Unapplied(), nil
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "suplantaciones", "invitaciones", "api_keys", "codigos_recuperacion", "usuario_mfa",
+	"empresa_usuarios", "empresas", "direcciones", "detalle_pedido", "pedidos", "usuarios", "productos";
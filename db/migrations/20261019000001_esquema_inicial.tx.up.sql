@@ -0,0 +1,74 @@
+-- Esquema creado hasta ahora por db.runMigrations. Usa IF NOT EXISTS para que las bases
+-- existentes, creadas con CreateTable().IfNotExists(), queden al día sin perder datos
+
+CREATE TABLE IF NOT EXISTS "productos" ("id" BIGSERIAL NOT NULL, "nombre" VARCHAR, "precio_venta" BIGINT, "precio_compra" BIGINT, "disponible" BOOLEAN, "ultima_vez_ingresado" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, "archivado_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "usuarios" ("id" BIGSERIAL NOT NULL, "nombre" VARCHAR, "apellido" VARCHAR, "email" VARCHAR, "password" VARCHAR, "rol" VARCHAR DEFAULT 'cliente', "ciudad" VARCHAR, "region_codigo" VARCHAR, "comuna_codigo" VARCHAR, "celular" VARCHAR, "verificado" BOOLEAN DEFAULT false, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, "deleted_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "pedidos" ("id" BIGSERIAL NOT NULL, "usuario_id" BIGINT, "total" BIGINT, "estado" VARCHAR, "fecha_envio" TIMESTAMPTZ, "ciudad_destino" VARCHAR, "region_destino" VARCHAR, "comuna_destino" VARCHAR, "direccion_destino" VARCHAR, "rut_destinatario" VARCHAR, "telefono_destino" VARCHAR, "company" VARCHAR, "tipo_envio" VARCHAR, "metodo_pago" VARCHAR, "tipo_documento" VARCHAR, "empresa_id" BIGINT, "factura_razon_social" VARCHAR, "factura_rut" VARCHAR, "factura_giro" VARCHAR, "factura_direccion_tributaria" VARCHAR, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "detalle_pedido" ("id" BIGSERIAL NOT NULL, "pedido_id" BIGINT, "producto_id" BIGINT, "nombre_producto" VARCHAR, "cantidad" BIGINT, "precio_unitario" BIGINT, "precio_total" BIGINT, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "direcciones" ("id" BIGSERIAL NOT NULL, "usuario_id" BIGINT, "alias" VARCHAR, "region" VARCHAR, "ciudad" VARCHAR, "comuna" VARCHAR, "region_codigo" VARCHAR, "comuna_codigo" VARCHAR, "direccion" VARCHAR, "rut" VARCHAR, "telefono" VARCHAR, "predeterminada" BOOLEAN DEFAULT false, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "empresas" ("id" BIGSERIAL NOT NULL, "razon_social" VARCHAR, "rut" VARCHAR, "giro" VARCHAR, "direccion_tributaria" VARCHAR, "comuna" VARCHAR, "ciudad" VARCHAR, "email_facturacion" VARCHAR, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, PRIMARY KEY ("id"), UNIQUE ("rut"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "empresa_usuarios" ("empresa_id" BIGINT NOT NULL, "usuario_id" BIGINT NOT NULL, "administrador" BOOLEAN DEFAULT false, "created_at" TIMESTAMPTZ, PRIMARY KEY ("empresa_id", "usuario_id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "usuario_mfa" ("usuario_id" BIGINT NOT NULL, "secreto" VARCHAR, "habilitado" BOOLEAN DEFAULT false, "ultimo_paso" BIGINT DEFAULT 0, "intentos" BIGINT DEFAULT 0, "bloqueado_hasta" TIMESTAMPTZ, "confirmado_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, "updated_at" TIMESTAMPTZ, PRIMARY KEY ("usuario_id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "codigos_recuperacion" ("id" BIGSERIAL NOT NULL, "usuario_id" BIGINT, "codigo_hash" VARCHAR, "usado_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "api_keys" ("id" BIGSERIAL NOT NULL, "usuario_id" BIGINT, "nombre" VARCHAR, "prefijo" VARCHAR, "key_hash" VARCHAR, "scopes" VARCHAR[], "expira_at" TIMESTAMPTZ, "ultimo_uso_at" TIMESTAMPTZ, "revocada_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, PRIMARY KEY ("id"), UNIQUE ("prefijo"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "invitaciones" ("id" BIGSERIAL NOT NULL, "usuario_id" BIGINT, "invitado_por" BIGINT, "token_hash" VARCHAR, "expira_at" TIMESTAMPTZ, "enviada_at" TIMESTAMPTZ, "envios" BIGINT DEFAULT 1, "aceptada_at" TIMESTAMPTZ, "cancelada_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, PRIMARY KEY ("id"), UNIQUE ("token_hash"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "suplantaciones" ("id" BIGSERIAL NOT NULL, "actor_id" BIGINT, "usuario_id" BIGINT, "motivo" VARCHAR, "ip" VARCHAR, "expira_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ, PRIMARY KEY ("id"));
+
+--bun:split
+
+-- Columnas que runMigrations agregaba a tablas creadas con versiones anteriores
+ALTER TABLE "productos" ADD COLUMN IF NOT EXISTS "archivado_at" TIMESTAMPTZ;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "region_codigo" VARCHAR;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "comuna_codigo" VARCHAR;
+ALTER TABLE "detalle_pedido" ADD COLUMN IF NOT EXISTS "nombre_producto" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "telefono_destino" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "region_destino" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "comuna_destino" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "empresa_id" BIGINT;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "factura_razon_social" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "factura_rut" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "factura_giro" VARCHAR;
+ALTER TABLE "pedidos" ADD COLUMN IF NOT EXISTS "factura_direccion_tributaria" VARCHAR;
+ALTER TABLE "direcciones" ADD COLUMN IF NOT EXISTS "region_codigo" VARCHAR;
+ALTER TABLE "direcciones" ADD COLUMN IF NOT EXISTS "comuna_codigo" VARCHAR;
+
+--bun:split
+
+-- Completar el nombre en las líneas creadas antes de guardar el snapshot
+UPDATE "detalle_pedido" AS d SET "nombre_producto" = p."nombre"
+FROM "productos" AS p
+WHERE d."producto_id" = p."id" AND d."nombre_producto" IS NULL;
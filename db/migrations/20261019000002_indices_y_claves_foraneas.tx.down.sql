@@ -0,0 +1,29 @@
+ALTER TABLE "suplantaciones" DROP CONSTRAINT IF EXISTS "suplantaciones_usuario_id_fkey";
+ALTER TABLE "suplantaciones" DROP CONSTRAINT IF EXISTS "suplantaciones_actor_id_fkey";
+ALTER TABLE "invitaciones" DROP CONSTRAINT IF EXISTS "invitaciones_invitado_por_fkey";
+ALTER TABLE "invitaciones" DROP CONSTRAINT IF EXISTS "invitaciones_usuario_id_fkey";
+ALTER TABLE "api_keys" DROP CONSTRAINT IF EXISTS "api_keys_usuario_id_fkey";
+ALTER TABLE "codigos_recuperacion" DROP CONSTRAINT IF EXISTS "codigos_recuperacion_usuario_id_fkey";
+ALTER TABLE "usuario_mfa" DROP CONSTRAINT IF EXISTS "usuario_mfa_usuario_id_fkey";
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT IF EXISTS "empresa_usuarios_usuario_id_fkey";
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT IF EXISTS "empresa_usuarios_empresa_id_fkey";
+ALTER TABLE "direcciones" DROP CONSTRAINT IF EXISTS "direcciones_usuario_id_fkey";
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT IF EXISTS "detalle_pedido_producto_id_fkey";
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT IF EXISTS "detalle_pedido_pedido_id_fkey";
+ALTER TABLE "pedidos" DROP CONSTRAINT IF EXISTS "pedidos_empresa_id_fkey";
+ALTER TABLE "pedidos" DROP CONSTRAINT IF EXISTS "pedidos_usuario_id_fkey";
+
+--bun:split
+
+DROP INDEX IF EXISTS "suplantaciones_actor_id_idx";
+DROP INDEX IF EXISTS "suplantaciones_usuario_id_idx";
+DROP INDEX IF EXISTS "invitaciones_usuario_id_idx";
+DROP INDEX IF EXISTS "api_keys_usuario_id_idx";
+DROP INDEX IF EXISTS "codigos_recuperacion_usuario_id_idx";
+DROP INDEX IF EXISTS "empresa_usuarios_usuario_id_idx";
+DROP INDEX IF EXISTS "direcciones_usuario_id_idx";
+DROP INDEX IF EXISTS "detalle_pedido_producto_id_idx";
+DROP INDEX IF EXISTS "detalle_pedido_pedido_id_idx";
+DROP INDEX IF EXISTS "pedidos_empresa_id_idx";
+DROP INDEX IF EXISTS "pedidos_usuario_id_idx";
+DROP INDEX IF EXISTS "usuarios_email_idx";
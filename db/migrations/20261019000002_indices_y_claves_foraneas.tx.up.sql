@@ -0,0 +1,31 @@
+-- Índices para las búsquedas más frecuentes
+CREATE INDEX IF NOT EXISTS "usuarios_email_idx" ON "usuarios" ("email");
+CREATE INDEX IF NOT EXISTS "pedidos_usuario_id_idx" ON "pedidos" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "pedidos_empresa_id_idx" ON "pedidos" ("empresa_id");
+CREATE INDEX IF NOT EXISTS "detalle_pedido_pedido_id_idx" ON "detalle_pedido" ("pedido_id");
+CREATE INDEX IF NOT EXISTS "detalle_pedido_producto_id_idx" ON "detalle_pedido" ("producto_id");
+CREATE INDEX IF NOT EXISTS "direcciones_usuario_id_idx" ON "direcciones" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "empresa_usuarios_usuario_id_idx" ON "empresa_usuarios" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "codigos_recuperacion_usuario_id_idx" ON "codigos_recuperacion" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "api_keys_usuario_id_idx" ON "api_keys" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "invitaciones_usuario_id_idx" ON "invitaciones" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "suplantaciones_usuario_id_idx" ON "suplantaciones" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "suplantaciones_actor_id_idx" ON "suplantaciones" ("actor_id");
+
+--bun:split
+
+-- Claves foráneas. Fallan si existen filas huérfanas, que deben corregirse antes de migrar
+ALTER TABLE "pedidos" ADD CONSTRAINT "pedidos_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "pedidos" ADD CONSTRAINT "pedidos_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id");
+ALTER TABLE "detalle_pedido" ADD CONSTRAINT "detalle_pedido_pedido_id_fkey" FOREIGN KEY ("pedido_id") REFERENCES "pedidos" ("id");
+ALTER TABLE "detalle_pedido" ADD CONSTRAINT "detalle_pedido_producto_id_fkey" FOREIGN KEY ("producto_id") REFERENCES "productos" ("id");
+ALTER TABLE "direcciones" ADD CONSTRAINT "direcciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "empresa_usuarios" ADD CONSTRAINT "empresa_usuarios_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id");
+ALTER TABLE "empresa_usuarios" ADD CONSTRAINT "empresa_usuarios_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "usuario_mfa" ADD CONSTRAINT "usuario_mfa_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "codigos_recuperacion" ADD CONSTRAINT "codigos_recuperacion_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "api_keys" ADD CONSTRAINT "api_keys_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "invitaciones" ADD CONSTRAINT "invitaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "invitaciones" ADD CONSTRAINT "invitaciones_invitado_por_fkey" FOREIGN KEY ("invitado_por") REFERENCES "usuarios" ("id");
+ALTER TABLE "suplantaciones" ADD CONSTRAINT "suplantaciones_actor_id_fkey" FOREIGN KEY ("actor_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "suplantaciones" ADD CONSTRAINT "suplantaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
@@ -0,0 +1,41 @@
+ALTER TABLE "suplantaciones" DROP CONSTRAINT "suplantaciones_usuario_id_fkey",
+	ADD CONSTRAINT "suplantaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "suplantaciones" DROP CONSTRAINT "suplantaciones_actor_id_fkey",
+	ADD CONSTRAINT "suplantaciones_actor_id_fkey" FOREIGN KEY ("actor_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "invitaciones" DROP CONSTRAINT "invitaciones_invitado_por_fkey",
+	ADD CONSTRAINT "invitaciones_invitado_por_fkey" FOREIGN KEY ("invitado_por") REFERENCES "usuarios" ("id");
+ALTER TABLE "invitaciones" DROP CONSTRAINT "invitaciones_usuario_id_fkey",
+	ADD CONSTRAINT "invitaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "api_keys" DROP CONSTRAINT "api_keys_usuario_id_fkey",
+	ADD CONSTRAINT "api_keys_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "codigos_recuperacion" DROP CONSTRAINT "codigos_recuperacion_usuario_id_fkey",
+	ADD CONSTRAINT "codigos_recuperacion_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "usuario_mfa" DROP CONSTRAINT "usuario_mfa_usuario_id_fkey",
+	ADD CONSTRAINT "usuario_mfa_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT "empresa_usuarios_usuario_id_fkey",
+	ADD CONSTRAINT "empresa_usuarios_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT "empresa_usuarios_empresa_id_fkey",
+	ADD CONSTRAINT "empresa_usuarios_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id");
+ALTER TABLE "direcciones" DROP CONSTRAINT "direcciones_usuario_id_fkey",
+	ADD CONSTRAINT "direcciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT "detalle_pedido_producto_id_fkey",
+	ADD CONSTRAINT "detalle_pedido_producto_id_fkey" FOREIGN KEY ("producto_id") REFERENCES "productos" ("id");
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT "detalle_pedido_pedido_id_fkey",
+	ADD CONSTRAINT "detalle_pedido_pedido_id_fkey" FOREIGN KEY ("pedido_id") REFERENCES "pedidos" ("id");
+ALTER TABLE "pedidos" DROP CONSTRAINT "pedidos_empresa_id_fkey",
+	ADD CONSTRAINT "pedidos_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id");
+ALTER TABLE "pedidos" DROP CONSTRAINT "pedidos_usuario_id_fkey",
+	ADD CONSTRAINT "pedidos_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id");
+
+--bun:split
+
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT IF EXISTS "detalle_pedido_precio_total_check";
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT IF EXISTS "detalle_pedido_precio_unitario_check";
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT IF EXISTS "detalle_pedido_cantidad_check";
+ALTER TABLE "pedidos" DROP CONSTRAINT IF EXISTS "pedidos_total_check";
+ALTER TABLE "productos" DROP CONSTRAINT IF EXISTS "productos_precio_compra_check";
+ALTER TABLE "productos" DROP CONSTRAINT IF EXISTS "productos_precio_venta_check";
+
+--bun:split
+
+DROP INDEX IF EXISTS "usuarios_email_lower_key";
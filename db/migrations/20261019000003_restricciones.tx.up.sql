@@ -0,0 +1,52 @@
+-- Los emails se guardan en minúsculas; el índice único ignora mayúsculas y a los usuarios eliminados
+-- (soft delete), cuyo email puede volver a registrarse. Falla si hay cuentas activas con el mismo email
+UPDATE "usuarios" SET "email" = lower(trim("email")) WHERE "email" <> lower(trim("email"));
+
+--bun:split
+
+CREATE UNIQUE INDEX "usuarios_email_lower_key" ON "usuarios" (lower("email")) WHERE "deleted_at" IS NULL;
+
+--bun:split
+
+-- Precios, totales y cantidades
+ALTER TABLE "productos" ADD CONSTRAINT "productos_precio_venta_check" CHECK ("precio_venta" >= 0);
+ALTER TABLE "productos" ADD CONSTRAINT "productos_precio_compra_check" CHECK ("precio_compra" >= 0);
+ALTER TABLE "pedidos" ADD CONSTRAINT "pedidos_total_check" CHECK ("total" >= 0);
+ALTER TABLE "detalle_pedido" ADD CONSTRAINT "detalle_pedido_cantidad_check" CHECK ("cantidad" > 0);
+ALTER TABLE "detalle_pedido" ADD CONSTRAINT "detalle_pedido_precio_unitario_check" CHECK ("precio_unitario" >= 0);
+ALTER TABLE "detalle_pedido" ADD CONSTRAINT "detalle_pedido_precio_total_check" CHECK ("precio_total" >= 0);
+
+--bun:split
+
+-- Comportamiento ON DELETE de las claves foráneas:
+-- los pedidos, sus productos y el registro de suplantaciones impiden borrar lo que referencian (RESTRICT);
+-- los datos que solo pertenecen al usuario, pedido o empresa se borran con él (CASCADE);
+-- el snapshot de facturación y el autor de una invitación sobreviven a su borrado (SET NULL)
+ALTER TABLE "pedidos" DROP CONSTRAINT "pedidos_usuario_id_fkey",
+	ADD CONSTRAINT "pedidos_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE RESTRICT;
+ALTER TABLE "pedidos" DROP CONSTRAINT "pedidos_empresa_id_fkey",
+	ADD CONSTRAINT "pedidos_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id") ON DELETE SET NULL;
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT "detalle_pedido_pedido_id_fkey",
+	ADD CONSTRAINT "detalle_pedido_pedido_id_fkey" FOREIGN KEY ("pedido_id") REFERENCES "pedidos" ("id") ON DELETE CASCADE;
+ALTER TABLE "detalle_pedido" DROP CONSTRAINT "detalle_pedido_producto_id_fkey",
+	ADD CONSTRAINT "detalle_pedido_producto_id_fkey" FOREIGN KEY ("producto_id") REFERENCES "productos" ("id") ON DELETE RESTRICT;
+ALTER TABLE "direcciones" DROP CONSTRAINT "direcciones_usuario_id_fkey",
+	ADD CONSTRAINT "direcciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT "empresa_usuarios_empresa_id_fkey",
+	ADD CONSTRAINT "empresa_usuarios_empresa_id_fkey" FOREIGN KEY ("empresa_id") REFERENCES "empresas" ("id") ON DELETE CASCADE;
+ALTER TABLE "empresa_usuarios" DROP CONSTRAINT "empresa_usuarios_usuario_id_fkey",
+	ADD CONSTRAINT "empresa_usuarios_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "usuario_mfa" DROP CONSTRAINT "usuario_mfa_usuario_id_fkey",
+	ADD CONSTRAINT "usuario_mfa_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "codigos_recuperacion" DROP CONSTRAINT "codigos_recuperacion_usuario_id_fkey",
+	ADD CONSTRAINT "codigos_recuperacion_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "api_keys" DROP CONSTRAINT "api_keys_usuario_id_fkey",
+	ADD CONSTRAINT "api_keys_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "invitaciones" DROP CONSTRAINT "invitaciones_usuario_id_fkey",
+	ADD CONSTRAINT "invitaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE CASCADE;
+ALTER TABLE "invitaciones" DROP CONSTRAINT "invitaciones_invitado_por_fkey",
+	ADD CONSTRAINT "invitaciones_invitado_por_fkey" FOREIGN KEY ("invitado_por") REFERENCES "usuarios" ("id") ON DELETE SET NULL;
+ALTER TABLE "suplantaciones" DROP CONSTRAINT "suplantaciones_actor_id_fkey",
+	ADD CONSTRAINT "suplantaciones_actor_id_fkey" FOREIGN KEY ("actor_id") REFERENCES "usuarios" ("id") ON DELETE RESTRICT;
+ALTER TABLE "suplantaciones" DROP CONSTRAINT "suplantaciones_usuario_id_fkey",
+	ADD CONSTRAINT "suplantaciones_usuario_id_fkey" FOREIGN KEY ("usuario_id") REFERENCES "usuarios" ("id") ON DELETE RESTRICT;
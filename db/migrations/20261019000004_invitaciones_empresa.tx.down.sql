@@ -0,0 +1,6 @@
+-- Las invitaciones pendientes no deben convertirse en membresías al quitar la columna
+DELETE FROM "empresa_usuarios" WHERE "aceptada_at" IS NULL;
+
+--bun:split
+
+ALTER TABLE "empresa_usuarios" DROP COLUMN IF EXISTS "aceptada_at";
@@ -0,0 +1,7 @@
+-- Las membresías agregadas por un administrador quedan pendientes hasta que el usuario las acepta;
+-- las existentes se consideran aceptadas desde su creación
+ALTER TABLE "empresa_usuarios" ADD COLUMN "aceptada_at" TIMESTAMPTZ;
+
+--bun:split
+
+UPDATE "empresa_usuarios" SET "aceptada_at" = COALESCE("created_at", now());
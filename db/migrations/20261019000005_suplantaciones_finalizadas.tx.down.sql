@@ -0,0 +1 @@
+ALTER TABLE "suplantaciones" DROP COLUMN IF EXISTS "finalizada_at";
@@ -0,0 +1,2 @@
+-- Una suplantación finalizada invalida su token aunque todavía no haya expirado
+ALTER TABLE "suplantaciones" ADD COLUMN "finalizada_at" TIMESTAMPTZ;
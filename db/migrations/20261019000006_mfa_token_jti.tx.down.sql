@@ -0,0 +1 @@
+ALTER TABLE "usuario_mfa" DROP COLUMN IF EXISTS "token_jti";
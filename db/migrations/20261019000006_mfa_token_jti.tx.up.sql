@@ -0,0 +1,2 @@
+-- Identificador del último token mfa_pending emitido; al verificarse se borra para que no pueda reutilizarse
+ALTER TABLE "usuario_mfa" ADD COLUMN "token_jti" VARCHAR;
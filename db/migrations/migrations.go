@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"embed"
+
+	"github.com/uptrace/bun/migrate"
+)
+
+// Los archivos SQL siguen el formato <versión>_<nombre>.[tx.]up.sql / .down.sql de bun/migrate;
+// los que llevan .tx se ejecutan dentro de una transacción
+//
+//go:embed *.sql
+var sqlMigrations embed.FS
+
+// Migrations contiene las migraciones versionadas de la base de datos
+var Migrations = migrate.NewMigrations()
+
+func init() {
+	if err := Migrations.Discover(sqlMigrations); err != nil {
+		panic(err)
+	}
+}
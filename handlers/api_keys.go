@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+type APIKeyHandler struct {
+	db *bun.DB
+}
+
+func NewAPIKeyHandler(db *bun.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// APIKeyResponse estructura para la respuesta JSON sin incluir el hash de la key
+type APIKeyResponse struct {
+	ID          int        `json:"id"`
+	UsuarioID   int        `json:"usuario_id"`
+	Nombre      string     `json:"nombre"`
+	Prefijo     string     `json:"prefijo"`
+	Scopes      []string   `json:"scopes"`
+	ExpiraAt    *time.Time `json:"expira_at,omitempty"`
+	UltimoUsoAt *time.Time `json:"ultimo_uso_at,omitempty"`
+	RevocadaAt  *time.Time `json:"revocada_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return APIKeyResponse{
+		ID:          key.ID,
+		UsuarioID:   key.UsuarioID,
+		Nombre:      key.Nombre,
+		Prefijo:     "eml_" + key.Prefijo,
+		Scopes:      scopes,
+		ExpiraAt:    key.ExpiraAt,
+		UltimoUsoAt: key.UltimoUsoAt,
+		RevocadaAt:  key.RevocadaAt,
+		CreatedAt:   key.CreatedAt,
+	}
+}
+
+// CreateAPIKey crea una API key para el usuario autenticado; la key completa solo se muestra en esta respuesta
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID := c.GetInt("userID")
+	rol := c.GetString("rol")
+
+	// Una API key no puede crear otras API keys
+	if c.GetString("authMethod") == utils.AuthMethodAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "No se pueden crear API keys autenticando con una API key",
+		})
+		return
+	}
+
+	var input struct {
+		Nombre        string   `json:"nombre" binding:"required"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	// Los scopes deben ser permisos que el rol del usuario ya tiene o scopes de autoservicio
+	for _, scope := range input.Scopes {
+		if !utils.ValidAPIKeyScope(rol, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Scope inválido o no permitido para tu rol: " + scope,
+			})
+			return
+		}
+	}
+	slices.Sort(input.Scopes)
+	input.Scopes = slices.Compact(input.Scopes)
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando la API key",
+		})
+		return
+	}
+
+	now := time.Now()
+	apiKey := models.APIKey{
+		UsuarioID: userID,
+		Nombre:    input.Nombre,
+		Prefijo:   prefix,
+		KeyHash:   hash,
+		Scopes:    input.Scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays > 0 {
+		expira := now.AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiraAt = &expira
+	}
+
+	_, err = h.db.NewInsert().Model(&apiKey).Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al guardar la API key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "API key creada. Guárdala ahora, no se volverá a mostrar",
+		"data": gin.H{
+			"key":     key,
+			"api_key": newAPIKeyResponse(apiKey),
+		},
+	})
+}
+
+// ListAPIKeys devuelve las API keys del usuario autenticado
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	h.respondAPIKeys(c, c.GetInt("userID"))
+}
+
+// ListUserAPIKeys devuelve las API keys de cualquier usuario (admin)
+func (h *APIKeyHandler) ListUserAPIKeys(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+	h.respondAPIKeys(c, userID)
+}
+
+func (h *APIKeyHandler) respondAPIKeys(c *gin.Context, userID int) {
+	var keys []models.APIKey
+	err := h.db.NewSelect().
+		Model(&keys).
+		Where("usuario_id = ?", userID).
+		OrderExpr("created_at DESC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las API keys",
+		})
+		return
+	}
+
+	respuesta := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		respuesta = append(respuesta, newAPIKeyResponse(key))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// RevokeAPIKey revoca una API key; puede hacerlo su dueño o quien tenga users:manage
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de API key inválido",
+		})
+		return
+	}
+
+	apiKey := new(models.APIKey)
+	err = h.db.NewSelect().Model(apiKey).Where("id = ?", keyID).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "API key no encontrada",
+		})
+		return
+	}
+
+	esDueno := apiKey.UsuarioID == c.GetInt("userID")
+	esAdmin := utils.HasPermission(c.GetString("rol"), utils.PermUsersManage) &&
+		c.GetString("authMethod") != utils.AuthMethodAPIKey
+	if !esDueno && !esAdmin {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "API key no encontrada",
+		})
+		return
+	}
+
+	if apiKey.RevocadaAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La API key ya fue revocada",
+		})
+		return
+	}
+
+	_, err = h.db.NewUpdate().
+		Model((*models.APIKey)(nil)).
+		Set("revocada_at = ?", time.Now()).
+		Where("id = ?", keyID).
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al revocar la API key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revocada correctamente",
+	})
+}
@@ -1,12 +1,12 @@
 package handlers
 
 import (
+	"cotizador-productos-eml/config"
 	"cotizador-productos-eml/models"
 	"cotizador-productos-eml/utils"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,18 +15,20 @@ import (
 )
 
 type AuthHandler struct {
-	db *bun.DB
+	db     *bun.DB
+	cfg    *config.Config
+	keys   *utils.JWTKeys
+	mailer *utils.Mailer
 }
 
 func (h *AuthHandler) GenerateTokens(userID int, email string, rol string) (string, string, error) {
 
 	// 2. Generar access token (vida más corta)
-	accessToken, err := utils.GenerateJWT(
+	accessToken, err := h.keys.GenerateJWT(
 		userID, // Incluir userID
 		email,
 		rol,
-		os.Getenv("JWT_SECRET"),
-		15*time.Minute, // 15 minutos (tiempo recomendado)
+		h.cfg.JWT.AccessTTL, // ACCESS_TOKEN_TTL, 15 minutos por defecto
 		"access",
 	)
 	if err != nil {
@@ -34,12 +36,11 @@ func (h *AuthHandler) GenerateTokens(userID int, email string, rol string) (stri
 	}
 
 	// 3. Generar refresh token (vida más larga)
-	refreshToken, err := utils.GenerateJWT(
+	refreshToken, err := h.keys.GenerateJWT(
 		userID,
 		email,
 		rol,
-		os.Getenv("JWT_SECRET"),
-		7*24*time.Hour, // 7 días (tiempo recomendado)
+		h.cfg.JWT.RefreshTTL, // REFRESH_TOKEN_TTL, 7 días por defecto
 		"refresh",
 	)
 	if err != nil {
@@ -49,8 +50,22 @@ func (h *AuthHandler) GenerateTokens(userID int, email string, rol string) (stri
 	return accessToken, refreshToken, nil
 }
 
-func NewAuthHandler(db *bun.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *bun.DB, cfg *config.Config, keys *utils.JWTKeys, mailer *utils.Mailer) *AuthHandler {
+	return &AuthHandler{db: db, cfg: cfg, keys: keys, mailer: mailer}
+}
+
+// checkPasswordPolicy responde 400 con el detalle de las reglas incumplidas y devuelve false si la contraseña no es válida
+func checkPasswordPolicy(c *gin.Context, password string, user utils.PasswordUser) bool {
+	errs := utils.ValidatePassword(password, user)
+	if len(errs) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error":   "La contraseña no cumple la política de seguridad",
+		"details": errs,
+	})
+	return false
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -61,6 +76,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 		Ciudad   string `json:"ciudad"`
+		Region   string `json:"region"`
+		Comuna   string `json:"comuna"`
 		Celular  string `json:"celular"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -71,6 +88,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	input.Email = utils.NormalizeEmail(input.Email)
+
 	// Verificar si el email ya está registrado
 	var usuario models.Usuario
 	err := h.db.NewSelect().Model(&usuario).Where("email = ?", input.Email).Scan(c)
@@ -81,6 +100,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		})
 		return
 	}
+	// Validar la contraseña contra la política de seguridad
+	if !checkPasswordPolicy(c, input.Password, utils.PasswordUser{Email: input.Email, Nombre: input.Nombre, Apellido: input.Apellido}) {
+		return
+	}
+
 	//Encriptar contraseña
 	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -99,42 +123,44 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email:     input.Email,
 		Password:  input.Password,
 		Rol:       "cliente",
-		Ciudad:    input.Ciudad,
 		Celular:   input.Celular,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	verificationToken, err := utils.GenerateJWT(
-		nuevoUsuario.ID,
-		nuevoUsuario.Email,
-		nuevoUsuario.Rol,
-		os.Getenv("JWT_SECRET"), // Debes tener configurado el secreto
-		24*time.Hour,
-		"verification",
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"succes": false,
-			"error":  "Error al generar token de verificación: " + err.Error(),
-		})
+	// La ciudad se guarda con el nombre oficial de la comuna y sus códigos
+	if !applyUbicacionUsuario(c, &nuevoUsuario, input.Comuna, input.Region, input.Ciudad) {
 		return
 	}
-	// Enviar email de verificación
-	if err := utils.SendVerificationEmail(nuevoUsuario.Email, verificationToken); err != nil {
-		// Registrar el error pero no fallar el registro
-		log.Printf("Error enviando email de verificación: %v", err)
-	}
 
-	// Insertar en la base de datos
+	// Insertar en la base de datos; el índice único de email cubre los registros simultáneos
 	_, err = h.db.NewInsert().Model(&nuevoUsuario).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"succes": false,
 			"error":  "Error al crear usuario" + err.Error(),
 		})
 		return
 	}
+
+	// Enviar email de verificación; el usuario ya existe, por lo que un error no falla el registro
+	// y puede pedir el reenvío
+	verificationToken, err := h.keys.GenerateJWT(
+		nuevoUsuario.ID,
+		nuevoUsuario.Email,
+		nuevoUsuario.Rol,
+		24*time.Hour,
+		"verification",
+	)
+	if err != nil {
+		slog.ErrorContext(c, "Error generando token de verificación", "error", err)
+	} else if err := h.mailer.SendVerificationEmail(c, nuevoUsuario.Email, verificationToken); err != nil {
+		slog.ErrorContext(c, "Error enviando email de verificación", "error", err)
+	}
+
 	// Respuesta exitosa (sin datos sensibles)
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -160,7 +186,7 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	// Parsear y validar el token JWT
-	claims, err := utils.ParseJWT(token, os.Getenv("JWT_SECRET"))
+	claims, err := h.keys.ParseJWT(token)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -234,7 +260,7 @@ func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
 	var usuario models.Usuario
 	err := h.db.NewSelect().
 		Model(&usuario).
-		Where("email = ?", input.Email).
+		Where("email = ?", utils.NormalizeEmail(input.Email)).
 		Scan(c)
 
 	if err != nil {
@@ -254,11 +280,10 @@ func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
 	}
 
 	// Generar nuevo token
-	verificationToken, err := utils.GenerateJWT(
+	verificationToken, err := h.keys.GenerateJWT(
 		usuario.ID,
 		usuario.Email,
 		usuario.Rol,
-		os.Getenv("JWT_SECRET"),
 		24*time.Hour,
 		"verification",
 	)
@@ -271,8 +296,8 @@ func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
 	}
 
 	// Enviar email
-	if err := utils.SendVerificationEmail(usuario.Email, verificationToken); err != nil {
-		log.Printf("Error enviando email de verificación: %v", err)
+	if err := h.mailer.SendVerificationEmail(c, usuario.Email, verificationToken); err != nil {
+		slog.ErrorContext(c, "Error enviando email de verificación", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error al reenviar el email de verificación",
@@ -306,7 +331,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var usuario models.Usuario
 	err := h.db.NewSelect().
 		Model(&usuario).
-		Where("email = ?", input.Email).
+		Where("email = ?", utils.NormalizeEmail(input.Email)).
 		Scan(c)
 
 	// Hash falso en caso de usuario inexistente (previene ataques de timing)
@@ -318,6 +343,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Comparar contraseña ingresada con la almacenada
 	if err != nil || bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(input.Password)) != nil {
+		utils.RecordLoginFallido(utils.LoginFalloCredenciales)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error":   "Credenciales inválidas",
@@ -327,6 +353,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Verificar si la cuenta está activada
 	if !usuario.Verificado {
+		utils.RecordLoginFallido(utils.LoginFalloNoVerificado)
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"error":   "Cuenta no verificada",
@@ -334,6 +361,29 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Si el usuario tiene 2FA (o debe configurarlo) los tokens se emiten en un segundo paso
+	mfa, err := getUsuarioMFA(c, h.db, usuario.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la configuración de 2FA",
+		})
+		return
+	}
+	if mfa != nil && mfa.Habilitado {
+		h.respondMFAChallenge(c, usuario, "mfa_pending")
+		return
+	}
+	if h.mfaRequiredFor(usuario.Rol) {
+		h.respondMFAChallenge(c, usuario, "mfa_enroll")
+		return
+	}
+
+	h.completeLogin(c, usuario)
+}
+
+// completeLogin genera los tokens, configura las cookies y responde el inicio de sesión
+func (h *AuthHandler) completeLogin(c *gin.Context, usuario models.Usuario) {
 	// Generar tokens
 	accessToken, refreshToken, err := h.GenerateTokens(usuario.ID, usuario.Email, usuario.Rol)
 	if err != nil {
@@ -343,39 +393,81 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		})
 		return
 	}
-	secureCookie := true
-
-	sameSite := http.SameSiteNoneMode
-	if os.Getenv("ENVIRONMENT") == "development" {
-		secureCookie = false
-		sameSite = http.SameSiteLaxMode
+	// Token CSRF para las mutaciones autenticadas con cookie (double-submit)
+	csrfToken, err := utils.GenerateCSRFToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando tokens",
+		})
+		return
 	}
+
+	secureCookie, sameSite := h.cookieOptions()
+	accessMaxAge := int(h.cfg.JWT.AccessTTL.Seconds())
+	refreshMaxAge := int(h.cfg.JWT.RefreshTTL.Seconds())
 	// Configurar cookies seguras
 	c.SetSameSite(sameSite)
-	// Access Token (expira en 1 hora)
-	c.SetCookie("access_token", accessToken, 3600, "/", os.Getenv("COOKIE_DOMAIN"), secureCookie, true)
+	// Access Token (expira junto con el token)
+	c.SetCookie("access_token", accessToken, accessMaxAge, "/", h.cfg.CookieDomain, secureCookie, true)
+
+	// Refresh Token (expira junto con el token)
+	c.SetCookie("refresh_token", refreshToken, refreshMaxAge, "/", h.cfg.CookieDomain, secureCookie, true)
 
-	// Refresh Token (expira en 7 días)
-	c.SetCookie("refresh_token", refreshToken, 604800, "/", os.Getenv("COOKIE_DOMAIN"), secureCookie, true)
+	// Token CSRF (no es HttpOnly para que el frontend pueda reenviarlo en X-CSRF-Token)
+	c.SetCookie(utils.CSRFCookieName, csrfToken, refreshMaxAge, "/", h.cfg.CookieDomain, secureCookie, false)
 
 	// Respuesta sin incluir tokens directamente en el cuerpo
 	c.JSON(http.StatusOK, gin.H{
 		"success":      true,
 		"message":      "Inicio de sesión exitoso",
 		"access_token": accessToken,
-		"expires_in":   3600, // Tiempo de expiración del access_token en segundos
+		"csrf_token":   csrfToken,
+		"expires_in":   accessMaxAge, // Tiempo de expiración del access_token en segundos
 	})
 }
 
-func (h *AuthHandler) Logout(c *gin.Context) {
-	secureCookie := true
-	if os.Getenv("ENVIRONMENT") == "development" {
-		secureCookie = false
+// cookieOptions devuelve la configuración de las cookies de sesión según el entorno
+func (h *AuthHandler) cookieOptions() (bool, http.SameSite) {
+	if h.cfg.IsDevelopment() {
+		return false, http.SameSiteLaxMode
 	}
+	return true, http.SameSiteNoneMode
+}
+
+// CSRFToken devuelve el token CSRF de la sesión actual, generándolo si la cookie no existe
+// (por ejemplo, cuando el frontend está en otro dominio y no puede leer la cookie)
+func (h *AuthHandler) CSRFToken(c *gin.Context) {
+	csrfToken, err := c.Cookie(utils.CSRFCookieName)
+	if err != nil || csrfToken == "" {
+		csrfToken, err = utils.GenerateCSRFToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Error generando token CSRF",
+			})
+			return
+		}
+		secureCookie, sameSite := h.cookieOptions()
+		c.SetSameSite(sameSite)
+		c.SetCookie(utils.CSRFCookieName, csrfToken, int(h.cfg.JWT.RefreshTTL.Seconds()), "/", h.cfg.CookieDomain, secureCookie, false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"csrf_token": csrfToken,
+		},
+	})
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	secureCookie := !h.cfg.IsDevelopment()
 	//Eliminar tokens de cookies
 	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("access_token", "", -1, "/", os.Getenv("COOKIE_DOMAIN"), secureCookie, true)
-	c.SetCookie("refresh_token", "", -1, "/", os.Getenv("COOKIE_DOMAIN"), secureCookie, true)
+	c.SetCookie("access_token", "", -1, "/", h.cfg.CookieDomain, secureCookie, true)
+	c.SetCookie("refresh_token", "", -1, "/", h.cfg.CookieDomain, secureCookie, true)
+	c.SetCookie(utils.CSRFCookieName, "", -1, "/", h.cfg.CookieDomain, secureCookie, false)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -396,7 +488,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ParseJWT(input.RefreshToken, os.Getenv("JWT_SECRET"))
+	claims, err := h.keys.ParseJWT(input.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -451,7 +543,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		"data": gin.H{
 			"access_token":  accessToken,
 			"refresh_token": refreshToken,
-			"expires_in":    3600,
+			"expires_in":    int(h.cfg.JWT.AccessTTL.Seconds()),
 		},
 	})
 }
@@ -473,7 +565,7 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 	var usuario models.Usuario
 	err := h.db.NewSelect().
 		Model(&usuario).
-		Where("email = ?", input.Email).
+		Where("email = ?", utils.NormalizeEmail(input.Email)).
 		Scan(c)
 
 	if err != nil {
@@ -484,12 +576,29 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
+	// Un usuario invitado debe activar su cuenta con la invitación
+	pendiente, err := tieneInvitacionPendiente(c, h.db, usuario.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Error verificando la invitación del usuario", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar el usuario",
+		})
+		return
+	}
+	if pendiente {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Tu cuenta aún no está activada; usa el enlace de tu invitación o pide que te la reenvíen",
+		})
+		return
+	}
+
 	// Generar token de cambio de contraseña
-	resetToken, err := utils.GenerateJWT(
+	resetToken, err := h.keys.GenerateJWT(
 		usuario.ID,
 		usuario.Email,
 		usuario.Rol,
-		os.Getenv("JWT_SECRET"),
 		24*time.Hour,
 		"reset_password",
 	)
@@ -502,8 +611,8 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 	}
 
 	// Enviar email
-	if err := utils.SendPasswordResetEmail(usuario.Email, resetToken); err != nil {
-		log.Printf("Error enviando email de reseteo: %v", err)
+	if err := h.mailer.SendPasswordResetEmail(c, usuario.Email, resetToken); err != nil {
+		slog.ErrorContext(c, "Error enviando email de reseteo", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error al enviar email de reseteo",
@@ -540,7 +649,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	}
 
 	// Verificar y parsear el token
-	claims, err := utils.ParseJWT(token, os.Getenv("JWT_SECRET"))
+	claims, err := h.keys.ParseJWT(token)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -581,6 +690,29 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Un usuario invitado solo se activa con su invitación, aunque tenga un token de reseteo
+	pendiente, err := tieneInvitacionPendiente(c, h.db, usuario.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Error verificando la invitación del usuario", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar el usuario",
+		})
+		return
+	}
+	if pendiente {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Tu cuenta aún no está activada; usa el enlace de tu invitación o pide que te la reenvíen",
+		})
+		return
+	}
+
+	// Validar la nueva contraseña contra la política de seguridad
+	if !checkPasswordPolicy(c, input.Password, utils.PasswordUser{Email: usuario.Email, Nombre: usuario.Nombre, Apellido: usuario.Apellido}) {
+		return
+	}
+
 	// Encriptar la nueva contraseña
 	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -623,7 +755,7 @@ func (h *AuthHandler) VerifyAuth(c *gin.Context) {
 		return
 	}
 	// Verificar y parsear el token
-	claims, err := utils.ParseJWT(accessToken, os.Getenv("JWT_SECRET"))
+	claims, err := h.keys.ParseJWT(accessToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
@@ -642,25 +774,7 @@ func (h *AuthHandler) VerifyAuth(c *gin.Context) {
 		return
 	}
 
-	email, ok := claims["email"].(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"success": false,
-			"error":   "Token inválido (email no encontrado)",
-		})
-		return
-	}
-
-	rol, ok := claims["rol"].(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"success": false,
-			"error":   "Token inválido (rol no encontrado)",
-		})
-		return
-	}
-
-	// Opcional: verificar que el usuario sigue existiendo en la base de datos
+	// Verificar que el usuario sigue existiendo; el email y el rol se toman de la base de datos y no del token
 	var usuario models.Usuario
 	err = h.db.NewSelect().
 		Model(&usuario).
@@ -681,10 +795,10 @@ func (h *AuthHandler) VerifyAuth(c *gin.Context) {
 		"data": gin.H{
 			"nombre":   usuario.Nombre,
 			"apellido": usuario.Apellido,
-			"email":    email,
+			"email":    usuario.Email,
 			"ciudad":   usuario.Ciudad,
 			"celular":  usuario.Celular,
-			"rol":      rol,
+			"rol":      usuario.Rol,
 		},
 	})
 }
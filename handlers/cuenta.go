@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// eliminacionCuentaTTL es la vigencia del enlace de confirmación para eliminar la cuenta
+const eliminacionCuentaTTL = time.Hour
+
+var errEmpresaSinAdmin = errors.New("el usuario es el único administrador de una empresa con otros miembros")
+
+const errEmpresaSinAdminMensaje = "Eres el único administrador de una empresa con otros miembros; designa otro administrador antes de eliminar la cuenta"
+
+// PerfilExport datos del perfil incluidos en la exportación
+type PerfilExport struct {
+	ID         int       `json:"id"`
+	Email      string    `json:"email"`
+	Nombre     string    `json:"nombre"`
+	Apellido   string    `json:"apellido"`
+	Celular    string    `json:"celular"`
+	Ciudad     string    `json:"ciudad"`
+	Region     string    `json:"region"`
+	Comuna     string    `json:"comuna"`
+	Rol        string    `json:"rol"`
+	Verificado bool      `json:"verificado"`
+	MFA        bool      `json:"mfa_habilitado"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DatosPersonalesExport reúne todos los datos del usuario autenticado
+type DatosPersonalesExport struct {
+	GeneradoAt  time.Time                 `json:"generado_at"`
+	Perfil      PerfilExport              `json:"perfil"`
+	Direcciones []DireccionResponse       `json:"direcciones"`
+	Empresas    []EmpresaResponse         `json:"empresas"`
+	Pedidos     []PedidoDetalladoResponse `json:"pedidos"`
+	APIKeys     []APIKeyResponse          `json:"api_keys"`
+}
+
+// ExportUserData devuelve los datos personales del usuario autenticado en JSON o, con ?format=zip, en un ZIP con un archivo por sección
+func (h *UserHandler) ExportUserData(c *gin.Context) {
+	if c.GetString("authMethod") == utils.AuthMethodAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "No se pueden exportar los datos con una API key",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Formato inválido, usa json o zip",
+		})
+		return
+	}
+
+	datos, err := h.collectUserData(c, c.GetInt("userID"))
+	if err != nil {
+		slog.ErrorContext(c, "Error al exportar los datos del usuario", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al exportar los datos",
+		})
+		return
+	}
+
+	nombre := fmt.Sprintf("datos-usuario-%d-%s", datos.Perfil.ID, datos.GeneradoAt.Format("20060102"))
+	c.Header("Cache-Control", "no-store")
+
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nombre+".json"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    datos,
+		})
+		return
+	}
+
+	archivos := []struct {
+		nombre    string
+		contenido interface{}
+	}{
+		{"perfil.json", datos.Perfil},
+		{"direcciones.json", datos.Direcciones},
+		{"empresas.json", datos.Empresas},
+		{"pedidos.json", datos.Pedidos},
+		{"api_keys.json", datos.APIKeys},
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nombre+".zip"))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, archivo := range archivos {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     archivo.nombre,
+			Method:   zip.Deflate,
+			Modified: datos.GeneradoAt,
+		})
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(archivo.contenido)
+		}
+		if err != nil {
+			// Las cabeceras ya se enviaron, solo queda cortar la descarga
+			slog.ErrorContext(c, "Error generando exportación de datos", "usuario_id", datos.Perfil.ID, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(c, "Error generando exportación de datos", "usuario_id", datos.Perfil.ID, "error", err)
+	}
+}
+
+// collectUserData carga el perfil, direcciones, empresas, pedidos con su detalle y API keys de un usuario
+func (h *UserHandler) collectUserData(ctx context.Context, userID int) (*DatosPersonalesExport, error) {
+	usuario := new(models.Usuario)
+	if err := h.db.NewSelect().Model(usuario).Where("id = ?", userID).Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	mfaHabilitado, err := h.db.NewSelect().
+		Model((*models.UsuarioMFA)(nil)).
+		Where("usuario_id = ?", userID).
+		Where("habilitado = true").
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	datos := &DatosPersonalesExport{
+		GeneradoAt: time.Now(),
+		Perfil: PerfilExport{
+			ID:         usuario.ID,
+			Email:      usuario.Email,
+			Nombre:     usuario.Nombre,
+			Apellido:   usuario.Apellido,
+			Celular:    usuario.Celular,
+			Ciudad:     usuario.Ciudad,
+			Region:     usuario.RegionCodigo,
+			Comuna:     usuario.ComunaCodigo,
+			Rol:        usuario.Rol,
+			Verificado: usuario.Verificado,
+			MFA:        mfaHabilitado,
+			CreatedAt:  usuario.CreatedAt,
+			UpdatedAt:  usuario.UpdatedAt,
+		},
+	}
+
+	var direcciones []models.Direccion
+	err = h.db.NewSelect().
+		Model(&direcciones).
+		Where("usuario_id = ?", userID).
+		OrderExpr("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	datos.Direcciones = make([]DireccionResponse, 0, len(direcciones))
+	for _, d := range direcciones {
+		datos.Direcciones = append(datos.Direcciones, newDireccionResponse(d))
+	}
+
+	var miembros []models.EmpresaUsuario
+	err = h.db.NewSelect().
+		Model(&miembros).
+		Relation("Empresa").
+		Where("empresa_usuario.usuario_id = ?", userID).
+		OrderExpr("empresa.razon_social ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	datos.Empresas = make([]EmpresaResponse, 0, len(miembros))
+	for _, m := range miembros {
+		datos.Empresas = append(datos.Empresas, newEmpresaResponse(*m.Empresa, m.Administrador))
+	}
+
+	var pedidos []models.Pedido
+	err = h.db.NewSelect().
+		Model(&pedidos).
+		Where("usuario_id = ?", userID).
+		OrderExpr("created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	detallesPorPedido := make(map[int][]DetallePedidoResponse, len(pedidos))
+	if len(pedidos) > 0 {
+		pedidoIDs := make([]int, 0, len(pedidos))
+		for _, p := range pedidos {
+			pedidoIDs = append(pedidoIDs, p.ID)
+		}
+		var detalles []models.DetallePedido
+		err = h.db.NewSelect().
+			Model(&detalles).
+			Relation("Producto").
+			Where("detalle_pedido.pedido_id IN (?)", bun.In(pedidoIDs)).
+			OrderExpr("detalle_pedido.id ASC").
+			Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range detalles {
+			detallesPorPedido[d.PedidoID] = append(detallesPorPedido[d.PedidoID], newDetallePedidoResponse(d))
+		}
+	}
+	datos.Pedidos = make([]PedidoDetalladoResponse, 0, len(pedidos))
+	for i := range pedidos {
+		detalles := detallesPorPedido[pedidos[i].ID]
+		if detalles == nil {
+			detalles = []DetallePedidoResponse{}
+		}
+		datos.Pedidos = append(datos.Pedidos, PedidoDetalladoResponse{
+			Pedido:   newPedidoResponse(&pedidos[i]),
+			Detalles: detalles,
+		})
+	}
+
+	var keys []models.APIKey
+	err = h.db.NewSelect().
+		Model(&keys).
+		Where("usuario_id = ?", userID).
+		OrderExpr("created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	datos.APIKeys = make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		datos.APIKeys = append(datos.APIKeys, newAPIKeyResponse(k))
+	}
+
+	return datos, nil
+}
+
+// RequestAccountDeletion envía al email del usuario el enlace para confirmar la eliminación de su cuenta
+func (h *UserHandler) RequestAccountDeletion(c *gin.Context) {
+	if c.GetString("authMethod") == utils.AuthMethodAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "No se puede eliminar la cuenta con una API key",
+		})
+		return
+	}
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Debes indicar tu contraseña para eliminar la cuenta",
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err := h.db.NewSelect().Model(user).Where("id = ?", c.GetInt("userID")).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "La contraseña es incorrecta",
+		})
+		return
+	}
+
+	// Avisar antes de enviar el enlace si la eliminación no podrá completarse
+	if !h.checkAccountDeletable(c, user) {
+		return
+	}
+
+	deleteToken, err := h.keys.GenerateJWT(user.ID, user.Email, user.Rol, eliminacionCuentaTTL, "delete_account")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando token de confirmación",
+		})
+		return
+	}
+
+	if err := h.mailer.SendAccountDeletionConfirmation(c, user.Email, deleteToken); err != nil {
+		slog.ErrorContext(c, "Error enviando email de eliminación de cuenta", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al enviar el email de confirmación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Te enviamos un enlace a tu email para confirmar la eliminación de la cuenta",
+	})
+}
+
+// ConfirmAccountDeletion anonimiza y elimina la cuenta a partir del enlace enviado por email.
+// Los pedidos se conservan por obligaciones contables
+func (h *UserHandler) ConfirmAccountDeletion(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token de confirmación requerido",
+		})
+		return
+	}
+
+	claims, err := h.keys.ParseJWT(input.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	if tokenType, ok := claims["type"].(string); !ok || tokenType != "delete_account" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Tipo de token inválido",
+		})
+		return
+	}
+
+	userID, ok := claims["sub"].(float64)
+	email, emailOk := claims["email"].(string)
+	if !ok || !emailOk {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido",
+		})
+		return
+	}
+
+	// Un usuario ya eliminado no se encuentra, por lo que el enlace solo sirve una vez
+	user := new(models.Usuario)
+	err = h.db.NewSelect().Model(user).Where("id = ?", int(userID)).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	// Si el email cambió después de la solicitud, el enlace ya no corresponde a la cuenta
+	if user.Email != email {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido",
+		})
+		return
+	}
+
+	if !h.checkAccountDeletable(c, user) {
+		return
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := anonymizeUsuario(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		_, err := tx.NewDelete().Model((*models.Usuario)(nil)).Where("id = ?", user.ID).Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errEmpresaSinAdmin) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   errEmpresaSinAdminMensaje,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al eliminar la cuenta",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Tu cuenta fue eliminada",
+	})
+}
+
+// checkAccountDeletable responde con error si el usuario no puede eliminar su propia cuenta
+func (h *UserHandler) checkAccountDeletable(c *gin.Context, user *models.Usuario) bool {
+	if err := ensureNotLastAdmin(c, h.db, user, ""); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUltimoAdmin) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	unicoAdmin, err := esUnicoAdminDeEmpresa(c, h.db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar las empresas del usuario",
+		})
+		return false
+	}
+	if unicoAdmin {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   errEmpresaSinAdminMensaje,
+		})
+		return false
+	}
+	return true
+}
+
+// anonymizeUsuario borra los datos personales del usuario, sus direcciones, credenciales y membresías en empresas.
+// Los pedidos y el registro del usuario se conservan para mantener la contabilidad
+func anonymizeUsuario(ctx context.Context, tx bun.Tx, userID int) error {
+	now := time.Now()
+	_, err := tx.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		Set("nombre = ?", "Usuario").
+		Set("apellido = ?", "eliminado").
+		Set("email = ?", fmt.Sprintf("eliminado-%d@anonimo.invalid", userID)).
+		Set("password = ''").
+		Set("ciudad = ''").
+		Set("region_codigo = ''").
+		Set("comuna_codigo = ''").
+		Set("celular = ''").
+		Set("updated_at = ?", now).
+		Where("id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.NewDelete().Model((*models.Direccion)(nil)).Where("usuario_id = ?", userID).Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.NewDelete().Model((*models.CodigoRecuperacion)(nil)).Where("usuario_id = ?", userID).Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.NewDelete().Model((*models.UsuarioMFA)(nil)).Where("usuario_id = ?", userID).Exec(ctx); err != nil {
+		return err
+	}
+	_, err = tx.NewUpdate().
+		Model((*models.APIKey)(nil)).
+		Set("revocada_at = ?", now).
+		Where("usuario_id = ?", userID).
+		Where("revocada_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Salir de las empresas sin dejar a ninguna con miembros pero sin administrador
+	unicoAdmin, err := esUnicoAdminDeEmpresa(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if unicoAdmin {
+		return errEmpresaSinAdmin
+	}
+	_, err = tx.NewDelete().Model((*models.EmpresaUsuario)(nil)).Where("usuario_id = ?", userID).Exec(ctx)
+	return err
+}
+
+// esUnicoAdminDeEmpresa indica si el usuario es el único administrador de alguna empresa que tiene otros miembros
+func esUnicoAdminDeEmpresa(ctx context.Context, db bun.IDB, userID int) (bool, error) {
+	return db.NewSelect().
+		Model((*models.EmpresaUsuario)(nil)).
+		Where("usuario_id = ?", userID).
+		Where("administrador = true").
+		Where("aceptada_at IS NOT NULL").
+		Where("EXISTS (SELECT 1 FROM empresa_usuarios AS otro WHERE otro.empresa_id = empresa_usuario.empresa_id AND otro.usuario_id <> empresa_usuario.usuario_id AND otro.aceptada_at IS NOT NULL)").
+		Where("NOT EXISTS (SELECT 1 FROM empresa_usuarios AS otro WHERE otro.empresa_id = empresa_usuario.empresa_id AND otro.usuario_id <> empresa_usuario.usuario_id AND otro.administrador AND otro.aceptada_at IS NOT NULL)").
+		Exists(ctx)
+}
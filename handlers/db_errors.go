@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// Códigos SQLSTATE de Postgres para violaciones de restricciones
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// constraintMessages traduce las restricciones definidas en db/migrations a mensajes para la API
+var constraintMessages = map[string]string{
+	"usuarios_email_lower_key":             "El email ya está registrado",
+	"empresas_rut_key":                     "Ya existe una empresa con ese RUT",
+	"productos_precio_venta_check":         "El precio de venta no puede ser negativo",
+	"productos_precio_compra_check":        "El precio de compra no puede ser negativo",
+	"pedidos_total_check":                  "El total del pedido no puede ser negativo",
+	"detalle_pedido_cantidad_check":        "La cantidad debe ser mayor a cero",
+	"detalle_pedido_precio_unitario_check": "El precio unitario no puede ser negativo",
+	"detalle_pedido_precio_total_check":    "El precio total no puede ser negativo",
+	"detalle_pedido_producto_id_fkey":      "El producto no existe",
+	"pedidos_empresa_id_fkey":              "La empresa no existe",
+}
+
+// constraintError traduce una violación de restricción de Postgres a un estado HTTP y un mensaje.
+// Devuelve false si err no es una violación de restricción
+func constraintError(err error) (int, string, bool) {
+	var pgErr pgdriver.Error
+	if !errors.As(err, &pgErr) {
+		return 0, "", false
+	}
+
+	var status int
+	var mensaje string
+	switch pgErr.Field('C') {
+	case pgUniqueViolation:
+		status, mensaje = http.StatusConflict, "El registro ya existe"
+	case pgForeignKeyViolation:
+		status, mensaje = http.StatusConflict, "El registro está relacionado con otros datos"
+	case pgCheckViolation, pgNotNullViolation:
+		status, mensaje = http.StatusBadRequest, "Datos inválidos"
+	default:
+		return 0, "", false
+	}
+
+	if m, ok := constraintMessages[pgErr.Field('n')]; ok {
+		mensaje = m
+	}
+	return status, mensaje, true
+}
+
+// respondConstraintError responde 409 o 400 si err es una violación de restricción y en ese caso devuelve true
+func respondConstraintError(c *gin.Context, err error) bool {
+	status, mensaje, ok := constraintError(err)
+	if !ok {
+		return false
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   mensaje,
+	})
+	return true
+}
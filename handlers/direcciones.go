@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+const maxDireccionesPorUsuario = 20
+
+type DireccionHandler struct {
+	db *bun.DB
+}
+
+func NewDireccionHandler(db *bun.DB) *DireccionHandler {
+	return &DireccionHandler{db: db}
+}
+
+// DireccionRequest estructura para crear o actualizar una dirección
+type DireccionRequest struct {
+	Alias          string `json:"alias" binding:"required"`
+	Region         string `json:"region" binding:"required"`
+	Ciudad         string `json:"ciudad" binding:"required"`
+	Comuna         string `json:"comuna" binding:"required"`
+	Direccion      string `json:"direccion" binding:"required"`
+	Rut            string `json:"rut" binding:"required"`
+	Telefono       string `json:"telefono"`
+	Predeterminada bool   `json:"predeterminada"`
+}
+
+// DireccionResponse estructura para la respuesta JSON sin incluir el campo Usuario
+type DireccionResponse struct {
+	ID             int       `json:"id"`
+	Alias          string    `json:"alias"`
+	Region         string    `json:"region"`
+	Ciudad         string    `json:"ciudad"`
+	Comuna         string    `json:"comuna"`
+	RegionCodigo   string    `json:"region_codigo"`
+	ComunaCodigo   string    `json:"comuna_codigo"`
+	Direccion      string    `json:"direccion"`
+	Rut            string    `json:"rut"`
+	Telefono       string    `json:"telefono"`
+	Predeterminada bool      `json:"predeterminada"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func newDireccionResponse(d models.Direccion) DireccionResponse {
+	return DireccionResponse{
+		ID:             d.ID,
+		Alias:          d.Alias,
+		Region:         d.Region,
+		Ciudad:         d.Ciudad,
+		Comuna:         d.Comuna,
+		RegionCodigo:   d.RegionCodigo,
+		ComunaCodigo:   d.ComunaCodigo,
+		Direccion:      d.Direccion,
+		Rut:            d.Rut,
+		Telefono:       d.Telefono,
+		Predeterminada: d.Predeterminada,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+// bindDireccion parsea y valida la dirección de la solicitud; la región y la comuna se normalizan con el listado oficial
+func bindDireccion(c *gin.Context) (*DireccionRequest, *utils.Comuna, bool) {
+	var req DireccionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	if !utils.ValidRUT(req.Rut) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "RUT inválido",
+		})
+		return nil, nil, false
+	}
+	comuna, ok := utils.ResolveComuna(req.Comuna, req.Region)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Comuna o región inválida; consulta GET /geo/regiones",
+		})
+		return nil, nil, false
+	}
+	region, _ := utils.FindRegion(comuna.RegionCodigo)
+	req.Comuna = comuna.Nombre
+	req.Region = region.Nombre
+
+	req.Rut = utils.NormalizeRUT(req.Rut)
+	req.Alias = strings.TrimSpace(req.Alias)
+	return &req, comuna, true
+}
+
+// unsetDefaultDirecciones quita la marca de predeterminada a las demás direcciones del usuario
+func unsetDefaultDirecciones(ctx context.Context, tx bun.Tx, userID, exceptID int) error {
+	_, err := tx.NewUpdate().
+		Model((*models.Direccion)(nil)).
+		Set("predeterminada = false").
+		Where("usuario_id = ?", userID).
+		Where("id <> ?", exceptID).
+		Where("predeterminada = true").
+		Exec(ctx)
+	return err
+}
+
+// GetDirecciones devuelve las direcciones del usuario autenticado, la predeterminada primero
+func (h *DireccionHandler) GetDirecciones(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var direcciones []models.Direccion
+	err := h.db.NewSelect().
+		Model(&direcciones).
+		Where("usuario_id = ?", userID).
+		OrderExpr("predeterminada DESC, created_at DESC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las direcciones",
+		})
+		return
+	}
+
+	respuesta := make([]DireccionResponse, 0, len(direcciones))
+	for _, d := range direcciones {
+		respuesta = append(respuesta, newDireccionResponse(d))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// CreateDireccion agrega una dirección a la libreta del usuario autenticado
+func (h *DireccionHandler) CreateDireccion(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	req, comuna, ok := bindDireccion(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.db.NewSelect().
+		Model((*models.Direccion)(nil)).
+		Where("usuario_id = ?", userID).
+		Count(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al contar las direcciones",
+		})
+		return
+	}
+	if count >= maxDireccionesPorUsuario {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Alcanzaste el máximo de direcciones guardadas",
+		})
+		return
+	}
+
+	now := time.Now()
+	direccion := models.Direccion{
+		UsuarioID:    userID,
+		Alias:        req.Alias,
+		Region:       req.Region,
+		Ciudad:       req.Ciudad,
+		Comuna:       req.Comuna,
+		RegionCodigo: comuna.RegionCodigo,
+		ComunaCodigo: comuna.Codigo,
+		Direccion:    req.Direccion,
+		Rut:          req.Rut,
+		Telefono:     req.Telefono,
+		// La primera dirección siempre queda como predeterminada
+		Predeterminada: req.Predeterminada || count == 0,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&direccion).Exec(ctx); err != nil {
+			return err
+		}
+		if direccion.Predeterminada {
+			return unsetDefaultDirecciones(ctx, tx, userID, direccion.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al guardar la dirección",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Dirección creada correctamente",
+		"data":    newDireccionResponse(direccion),
+	})
+}
+
+// UpdateDireccion modifica una dirección del usuario autenticado
+func (h *DireccionHandler) UpdateDireccion(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	direccionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de dirección inválido",
+		})
+		return
+	}
+
+	req, comuna, ok := bindDireccion(c)
+	if !ok {
+		return
+	}
+
+	direccion := new(models.Direccion)
+	err = h.db.NewSelect().
+		Model(direccion).
+		Where("id = ?", direccionID).
+		Where("usuario_id = ?", userID).
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Dirección no encontrada",
+		})
+		return
+	}
+
+	direccion.Alias = req.Alias
+	direccion.Region = req.Region
+	direccion.Ciudad = req.Ciudad
+	direccion.Comuna = req.Comuna
+	direccion.RegionCodigo = comuna.RegionCodigo
+	direccion.ComunaCodigo = comuna.Codigo
+	direccion.Direccion = req.Direccion
+	direccion.Rut = req.Rut
+	direccion.Telefono = req.Telefono
+	// Para quitar la predeterminada hay que marcar otra dirección
+	direccion.Predeterminada = direccion.Predeterminada || req.Predeterminada
+	direccion.UpdatedAt = time.Now()
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewUpdate().Model(direccion).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if direccion.Predeterminada {
+			return unsetDefaultDirecciones(ctx, tx, userID, direccion.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la dirección",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Dirección actualizada correctamente",
+		"data":    newDireccionResponse(*direccion),
+	})
+}
+
+// SetDefaultDireccion marca una dirección como predeterminada
+func (h *DireccionHandler) SetDefaultDireccion(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	direccionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de dirección inválido",
+		})
+		return
+	}
+
+	var rowsAffected int64
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model((*models.Direccion)(nil)).
+			Set("predeterminada = true").
+			Set("updated_at = ?", time.Now()).
+			Where("id = ?", direccionID).
+			Where("usuario_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		rowsAffected, _ = result.RowsAffected()
+		if rowsAffected == 0 {
+			return nil
+		}
+		return unsetDefaultDirecciones(ctx, tx, userID, direccionID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la dirección",
+		})
+		return
+	}
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Dirección no encontrada",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Dirección predeterminada actualizada",
+	})
+}
+
+// DeleteDireccion elimina una dirección; si era la predeterminada se marca la más reciente
+func (h *DireccionHandler) DeleteDireccion(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	direccionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de dirección inválido",
+		})
+		return
+	}
+
+	direccion := new(models.Direccion)
+	err = h.db.NewSelect().
+		Model(direccion).
+		Where("id = ?", direccionID).
+		Where("usuario_id = ?", userID).
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Dirección no encontrada",
+		})
+		return
+	}
+
+	// Los pedidos copian los datos de la dirección, por lo que puede eliminarse sin afectarlos
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model(direccion).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if !direccion.Predeterminada {
+			return nil
+		}
+		_, err := tx.NewUpdate().
+			Model((*models.Direccion)(nil)).
+			Set("predeterminada = true").
+			Where("id = (?)", tx.NewSelect().
+				Model((*models.Direccion)(nil)).
+				Column("id").
+				Where("usuario_id = ?", userID).
+				OrderExpr("created_at DESC").
+				Limit(1)).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al eliminar la dirección",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Dirección eliminada correctamente",
+	})
+}
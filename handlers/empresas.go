@@ -0,0 +1,849 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+// tipoDocumentoFactura es el tipo de documento que requiere datos de facturación de una empresa
+const tipoDocumentoFactura = "factura"
+
+var errEmpresaNoEncontrada = errors.New("empresa no encontrada")
+
+type EmpresaHandler struct {
+	db     *bun.DB
+	mailer *utils.Mailer
+}
+
+func NewEmpresaHandler(db *bun.DB, mailer *utils.Mailer) *EmpresaHandler {
+	return &EmpresaHandler{db: db, mailer: mailer}
+}
+
+// EmpresaRequest estructura para crear o actualizar una empresa
+type EmpresaRequest struct {
+	RazonSocial         string `json:"razon_social" binding:"required"`
+	Rut                 string `json:"rut" binding:"required"`
+	Giro                string `json:"giro" binding:"required"`
+	DireccionTributaria string `json:"direccion_tributaria" binding:"required"`
+	Comuna              string `json:"comuna" binding:"required"`
+	Ciudad              string `json:"ciudad" binding:"required"`
+	EmailFacturacion    string `json:"email_facturacion" binding:"omitempty,email"`
+}
+
+// AddEmpresaMiembroRequest estructura para agregar un usuario a una empresa
+type AddEmpresaMiembroRequest struct {
+	Email         string `json:"email" binding:"required,email"`
+	Administrador bool   `json:"administrador"`
+}
+
+// ReassignEmpresaRequest estructura para que el personal entregue una empresa a su titular
+type ReassignEmpresaRequest struct {
+	Rut   string `json:"rut" binding:"required"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+// EmpresaResponse estructura para la respuesta JSON de una empresa
+type EmpresaResponse struct {
+	ID                  int       `json:"id"`
+	RazonSocial         string    `json:"razon_social"`
+	Rut                 string    `json:"rut"`
+	Giro                string    `json:"giro"`
+	DireccionTributaria string    `json:"direccion_tributaria"`
+	Comuna              string    `json:"comuna"`
+	Ciudad              string    `json:"ciudad"`
+	EmailFacturacion    string    `json:"email_facturacion"`
+	Administrador       bool      `json:"administrador"`
+	Completa            bool      `json:"completa"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// EmpresaMiembroResponse estructura para la respuesta JSON de un miembro de la empresa
+type EmpresaMiembroResponse struct {
+	UsuarioID     int       `json:"usuario_id"`
+	Nombre        string    `json:"nombre"`
+	Apellido      string    `json:"apellido"`
+	Email         string    `json:"email"`
+	Administrador bool      `json:"administrador"`
+	Pendiente     bool      `json:"pendiente"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// EmpresaInvitacionResponse estructura para la respuesta JSON de una invitación pendiente a una empresa
+type EmpresaInvitacionResponse struct {
+	EmpresaID     int       `json:"empresa_id"`
+	RazonSocial   string    `json:"razon_social"`
+	Rut           string    `json:"rut"`
+	Administrador bool      `json:"administrador"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newEmpresaResponse(e models.Empresa, administrador bool) EmpresaResponse {
+	return EmpresaResponse{
+		ID:                  e.ID,
+		RazonSocial:         e.RazonSocial,
+		Rut:                 e.Rut,
+		Giro:                e.Giro,
+		DireccionTributaria: e.DireccionTributaria,
+		Comuna:              e.Comuna,
+		Ciudad:              e.Ciudad,
+		EmailFacturacion:    e.EmailFacturacion,
+		Administrador:       administrador,
+		Completa:            len(camposFacturacionFaltantes(&e)) == 0,
+		CreatedAt:           e.CreatedAt,
+		UpdatedAt:           e.UpdatedAt,
+	}
+}
+
+// camposFacturacionFaltantes devuelve los campos requeridos para emitir una factura que la empresa no tiene
+func camposFacturacionFaltantes(e *models.Empresa) []string {
+	var faltantes []string
+	if strings.TrimSpace(e.RazonSocial) == "" {
+		faltantes = append(faltantes, "razon_social")
+	}
+	if !utils.ValidRUT(e.Rut) {
+		faltantes = append(faltantes, "rut")
+	}
+	if strings.TrimSpace(e.Giro) == "" {
+		faltantes = append(faltantes, "giro")
+	}
+	if strings.TrimSpace(e.DireccionTributaria) == "" {
+		faltantes = append(faltantes, "direccion_tributaria")
+	}
+	if strings.TrimSpace(e.Comuna) == "" {
+		faltantes = append(faltantes, "comuna")
+	}
+	return faltantes
+}
+
+// getEmpresaDeUsuario obtiene una empresa a la que pertenece el usuario junto con su membresía.
+// Las invitaciones pendientes no cuentan como membresía
+func getEmpresaDeUsuario(ctx context.Context, db bun.IDB, empresaID, usuarioID int) (*models.EmpresaUsuario, error) {
+	miembro := new(models.EmpresaUsuario)
+	err := db.NewSelect().
+		Model(miembro).
+		Relation("Empresa").
+		Where("empresa_usuario.empresa_id = ?", empresaID).
+		Where("empresa_usuario.usuario_id = ?", usuarioID).
+		Where("empresa_usuario.aceptada_at IS NOT NULL").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errEmpresaNoEncontrada
+	}
+	if err != nil {
+		return nil, err
+	}
+	return miembro, nil
+}
+
+// bloquearEmpresa bloquea la fila de la empresa hasta el fin de la transacción, para que dos cambios de
+// membresía simultáneos no dejen a la empresa sin administradores
+func bloquearEmpresa(ctx context.Context, tx bun.Tx, empresaID int) error {
+	_, err := tx.NewSelect().
+		Model((*models.Empresa)(nil)).
+		Column("id").
+		Where("id = ?", empresaID).
+		For("UPDATE").
+		Exec(ctx)
+	return err
+}
+
+// snapshotFacturacion copia los datos de facturación de la empresa en el pedido
+func snapshotFacturacion(pedido *models.Pedido, empresa *models.Empresa) {
+	pedido.EmpresaID = &empresa.ID
+	pedido.FacturaRazonSocial = empresa.RazonSocial
+	pedido.FacturaRut = empresa.Rut
+	pedido.FacturaGiro = empresa.Giro
+	pedido.FacturaDireccionTributaria = empresa.DireccionTributaria + ", " + empresa.Comuna
+	if empresa.Ciudad != "" {
+		pedido.FacturaDireccionTributaria += ", " + empresa.Ciudad
+	}
+}
+
+// bindEmpresa parsea y valida los datos de la empresa de la solicitud
+func bindEmpresa(c *gin.Context) (*EmpresaRequest, bool) {
+	var req EmpresaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	if !utils.ValidRUT(req.Rut) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "RUT de empresa inválido",
+		})
+		return nil, false
+	}
+	req.Rut = utils.NormalizeRUT(req.Rut)
+	req.RazonSocial = strings.TrimSpace(req.RazonSocial)
+	req.Giro = strings.TrimSpace(req.Giro)
+	req.EmailFacturacion = strings.ToLower(strings.TrimSpace(req.EmailFacturacion))
+	return &req, true
+}
+
+// requireEmpresaAdmin obtiene la empresa y verifica que el usuario autenticado sea administrador de ella
+func (h *EmpresaHandler) requireEmpresaAdmin(c *gin.Context) (*models.EmpresaUsuario, bool) {
+	empresaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de empresa inválido",
+		})
+		return nil, false
+	}
+
+	miembro, err := getEmpresaDeUsuario(c, h.db, empresaID, c.GetInt("userID"))
+	if errors.Is(err, errEmpresaNoEncontrada) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Empresa no encontrada",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la empresa",
+		})
+		return nil, false
+	}
+	if !miembro.Administrador {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Solo un administrador de la empresa puede realizar esta acción",
+		})
+		return nil, false
+	}
+	return miembro, true
+}
+
+// GetEmpresas devuelve las empresas a las que pertenece el usuario autenticado
+func (h *EmpresaHandler) GetEmpresas(c *gin.Context) {
+	var miembros []models.EmpresaUsuario
+	err := h.db.NewSelect().
+		Model(&miembros).
+		Relation("Empresa").
+		Where("empresa_usuario.usuario_id = ?", c.GetInt("userID")).
+		Where("empresa_usuario.aceptada_at IS NOT NULL").
+		OrderExpr("empresa.razon_social ASC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las empresas",
+		})
+		return
+	}
+
+	respuesta := make([]EmpresaResponse, 0, len(miembros))
+	for _, m := range miembros {
+		respuesta = append(respuesta, newEmpresaResponse(*m.Empresa, m.Administrador))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// CreateEmpresa registra una empresa; el usuario que la crea queda como administrador
+func (h *EmpresaHandler) CreateEmpresa(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	req, ok := bindEmpresa(c)
+	if !ok {
+		return
+	}
+
+	// Un RUT solo puede tener una cuenta; los demás usuarios deben ser agregados por un administrador
+	exists, err := h.db.NewSelect().
+		Model((*models.Empresa)(nil)).
+		Where("rut = ?", req.Rut).
+		Exists(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar la empresa",
+		})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "La empresa ya está registrada; pide a un administrador de la empresa que te agregue o contacta a soporte si eres su titular",
+		})
+		return
+	}
+
+	now := time.Now()
+	empresa := models.Empresa{
+		RazonSocial:         req.RazonSocial,
+		Rut:                 req.Rut,
+		Giro:                req.Giro,
+		DireccionTributaria: req.DireccionTributaria,
+		Comuna:              req.Comuna,
+		Ciudad:              req.Ciudad,
+		EmailFacturacion:    req.EmailFacturacion,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&empresa).Exec(ctx); err != nil {
+			return err
+		}
+		miembro := models.EmpresaUsuario{
+			EmpresaID:     empresa.ID,
+			UsuarioID:     userID,
+			Administrador: true,
+			AceptadaAt:    &now,
+			CreatedAt:     now,
+		}
+		_, err := tx.NewInsert().Model(&miembro).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al crear la empresa",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Empresa creada correctamente",
+		"data":    newEmpresaResponse(empresa, true),
+	})
+}
+
+// ReassignEmpresa entrega una empresa a otro usuario como único administrador. Lo usa el personal cuando
+// alguien registró un RUT que no le pertenece: se quitan todos los miembros e invitaciones de la empresa
+func (h *EmpresaHandler) ReassignEmpresa(c *gin.Context) {
+	var req ReassignEmpresaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+	if !utils.ValidRUT(req.Rut) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "RUT de empresa inválido",
+		})
+		return
+	}
+
+	empresa := new(models.Empresa)
+	err := h.db.NewSelect().
+		Model(empresa).
+		Where("rut = ?", utils.NormalizeRUT(req.Rut)).
+		Scan(c)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Empresa no encontrada",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la empresa",
+		})
+		return
+	}
+
+	usuario := new(models.Usuario)
+	err = h.db.NewSelect().
+		Model(usuario).
+		Column("id", "email").
+		Where("LOWER(email) = LOWER(?)", strings.TrimSpace(req.Email)).
+		Scan(c)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener el usuario",
+		})
+		return
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := bloquearEmpresa(ctx, tx, empresa.ID); err != nil {
+			return err
+		}
+		_, err := tx.NewDelete().
+			Model((*models.EmpresaUsuario)(nil)).
+			Where("empresa_id = ?", empresa.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		titular := models.EmpresaUsuario{
+			EmpresaID:     empresa.ID,
+			UsuarioID:     usuario.ID,
+			Administrador: true,
+			AceptadaAt:    &now,
+			CreatedAt:     now,
+		}
+		_, err = tx.NewInsert().Model(&titular).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(c, "Error reasignando la empresa", "empresa_id", empresa.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al reasignar la empresa",
+		})
+		return
+	}
+
+	slog.InfoContext(c, "Empresa reasignada", "empresa_id", empresa.ID, "titular_id", usuario.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Empresa reasignada correctamente",
+		"data":    newEmpresaResponse(*empresa, true),
+	})
+}
+
+// UpdateEmpresa modifica los datos de facturación de una empresa
+func (h *EmpresaHandler) UpdateEmpresa(c *gin.Context) {
+	miembro, ok := h.requireEmpresaAdmin(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindEmpresa(c)
+	if !ok {
+		return
+	}
+
+	empresa := miembro.Empresa
+	if req.Rut != empresa.Rut {
+		exists, err := h.db.NewSelect().
+			Model((*models.Empresa)(nil)).
+			Where("rut = ?", req.Rut).
+			Where("id <> ?", empresa.ID).
+			Exists(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Error al verificar la empresa",
+			})
+			return
+		}
+		if exists {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Ya existe otra empresa con ese RUT",
+			})
+			return
+		}
+	}
+
+	empresa.RazonSocial = req.RazonSocial
+	empresa.Rut = req.Rut
+	empresa.Giro = req.Giro
+	empresa.DireccionTributaria = req.DireccionTributaria
+	empresa.Comuna = req.Comuna
+	empresa.Ciudad = req.Ciudad
+	empresa.EmailFacturacion = req.EmailFacturacion
+	empresa.UpdatedAt = time.Now()
+
+	// Los pedidos ya creados conservan los datos copiados al momento de la compra
+	_, err := h.db.NewUpdate().Model(empresa).WherePK().Exec(c)
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la empresa",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Empresa actualizada correctamente",
+		"data":    newEmpresaResponse(*empresa, true),
+	})
+}
+
+// GetEmpresaMiembros lista los usuarios de una empresa
+func (h *EmpresaHandler) GetEmpresaMiembros(c *gin.Context) {
+	miembro, ok := h.requireEmpresaAdmin(c)
+	if !ok {
+		return
+	}
+
+	var miembros []models.EmpresaUsuario
+	err := h.db.NewSelect().
+		Model(&miembros).
+		Relation("Usuario").
+		Where("empresa_usuario.empresa_id = ?", miembro.EmpresaID).
+		OrderExpr("empresa_usuario.created_at ASC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener los miembros de la empresa",
+		})
+		return
+	}
+
+	respuesta := make([]EmpresaMiembroResponse, 0, len(miembros))
+	for _, m := range miembros {
+		// Los usuarios eliminados no se cargan en la relación
+		if m.Usuario == nil || m.Usuario.ID == 0 {
+			continue
+		}
+		respuesta = append(respuesta, EmpresaMiembroResponse{
+			UsuarioID:     m.UsuarioID,
+			Nombre:        m.Usuario.Nombre,
+			Apellido:      m.Usuario.Apellido,
+			Email:         m.Usuario.Email,
+			Administrador: m.Administrador,
+			Pendiente:     m.AceptadaAt == nil,
+			CreatedAt:     m.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// AddEmpresaMiembro invita a un usuario registrado a la empresa o cambia el rol de un miembro.
+// El usuario queda pendiente hasta aceptar la invitación, y la respuesta es la misma exista o no
+// una cuenta con ese email, para no revelar qué emails están registrados
+func (h *EmpresaHandler) AddEmpresaMiembro(c *gin.Context) {
+	miembro, ok := h.requireEmpresaAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req AddEmpresaMiembroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	respuestaInvitacion := gin.H{
+		"success": true,
+		"message": "Si el email corresponde a un usuario registrado, recibirá una invitación para unirse a la empresa",
+	}
+
+	usuario := new(models.Usuario)
+	err := h.db.NewSelect().
+		Model(usuario).
+		Column("id", "email").
+		Where("LOWER(email) = LOWER(?)", strings.TrimSpace(req.Email)).
+		Scan(c)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusOK, respuestaInvitacion)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c, "Error buscando el usuario a invitar", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al agregar el usuario a la empresa",
+		})
+		return
+	}
+
+	var invitado bool
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := bloquearEmpresa(ctx, tx, miembro.EmpresaID); err != nil {
+			return err
+		}
+
+		existente := new(models.EmpresaUsuario)
+		err := tx.NewSelect().
+			Model(existente).
+			Where("empresa_id = ?", miembro.EmpresaID).
+			Where("usuario_id = ?", usuario.ID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			nuevo := models.EmpresaUsuario{
+				EmpresaID:     miembro.EmpresaID,
+				UsuarioID:     usuario.ID,
+				Administrador: req.Administrador,
+				CreatedAt:     time.Now(),
+			}
+			if _, err := tx.NewInsert().Model(&nuevo).Exec(ctx); err != nil {
+				return err
+			}
+			invitado = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Quitar el rol de administrador no puede dejar a la empresa sin administradores
+		if existente.Administrador && !req.Administrador && existente.AceptadaAt != nil {
+			otrosAdmins, err := tx.NewSelect().
+				Model((*models.EmpresaUsuario)(nil)).
+				Where("empresa_id = ?", miembro.EmpresaID).
+				Where("usuario_id <> ?", usuario.ID).
+				Where("administrador = true").
+				Where("aceptada_at IS NOT NULL").
+				Count(ctx)
+			if err != nil {
+				return err
+			}
+			if otrosAdmins == 0 {
+				return errUltimoAdmin
+			}
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.EmpresaUsuario)(nil)).
+			Set("administrador = ?", req.Administrador).
+			Where("empresa_id = ?", miembro.EmpresaID).
+			Where("usuario_id = ?", usuario.ID).
+			Exec(ctx)
+		// Una invitación pendiente se vuelve a enviar
+		invitado = err == nil && existente.AceptadaAt == nil
+		return err
+	})
+	if errors.Is(err, errUltimoAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La empresa debe conservar al menos un administrador",
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c, "Error agregando el usuario a la empresa", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al agregar el usuario a la empresa",
+		})
+		return
+	}
+
+	if !invitado {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Miembro actualizado",
+		})
+		return
+	}
+
+	if err := h.mailer.SendCompanyInvitationEmail(c, usuario.Email, miembro.Empresa.RazonSocial); err != nil {
+		slog.ErrorContext(c, "Error enviando la invitación a la empresa", "empresa_id", miembro.EmpresaID, "error", err)
+	}
+	c.JSON(http.StatusOK, respuestaInvitacion)
+}
+
+// GetEmpresaInvitaciones lista las invitaciones a empresas pendientes del usuario autenticado
+func (h *EmpresaHandler) GetEmpresaInvitaciones(c *gin.Context) {
+	var miembros []models.EmpresaUsuario
+	err := h.db.NewSelect().
+		Model(&miembros).
+		Relation("Empresa").
+		Where("empresa_usuario.usuario_id = ?", c.GetInt("userID")).
+		Where("empresa_usuario.aceptada_at IS NULL").
+		OrderExpr("empresa_usuario.created_at DESC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las invitaciones",
+		})
+		return
+	}
+
+	respuesta := make([]EmpresaInvitacionResponse, 0, len(miembros))
+	for _, m := range miembros {
+		respuesta = append(respuesta, EmpresaInvitacionResponse{
+			EmpresaID:     m.EmpresaID,
+			RazonSocial:   m.Empresa.RazonSocial,
+			Rut:           m.Empresa.Rut,
+			Administrador: m.Administrador,
+			CreatedAt:     m.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// AcceptEmpresaInvitacion acepta una invitación pendiente; para rechazarla el usuario sale de la empresa
+func (h *EmpresaHandler) AcceptEmpresaInvitacion(c *gin.Context) {
+	empresaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de empresa inválido",
+		})
+		return
+	}
+
+	result, err := h.db.NewUpdate().
+		Model((*models.EmpresaUsuario)(nil)).
+		Set("aceptada_at = ?", time.Now()).
+		Where("empresa_id = ?", empresaID).
+		Where("usuario_id = ?", c.GetInt("userID")).
+		Where("aceptada_at IS NULL").
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al aceptar la invitación",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Invitación no encontrada",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Te uniste a la empresa",
+	})
+}
+
+// RemoveEmpresaMiembro quita un usuario de la empresa; un usuario también puede salir por sí mismo
+func (h *EmpresaHandler) RemoveEmpresaMiembro(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	empresaID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de empresa inválido",
+		})
+		return
+	}
+	usuarioID, err := strconv.Atoi(c.Param("usuario_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+
+	if usuarioID != userID {
+		if _, ok := h.requireEmpresaAdmin(c); !ok {
+			return
+		}
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := bloquearEmpresa(ctx, tx, empresaID); err != nil {
+			return err
+		}
+
+		result, err := tx.NewDelete().
+			Model((*models.EmpresaUsuario)(nil)).
+			Where("empresa_id = ?", empresaID).
+			Where("usuario_id = ?", usuarioID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errEmpresaNoEncontrada
+		}
+
+		// La empresa no puede quedar sin administradores mientras tenga miembros; las invitaciones pendientes no cuentan
+		miembros, err := tx.NewSelect().
+			Model((*models.EmpresaUsuario)(nil)).
+			Where("empresa_id = ?", empresaID).
+			Where("aceptada_at IS NOT NULL").
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		admins, err := tx.NewSelect().
+			Model((*models.EmpresaUsuario)(nil)).
+			Where("empresa_id = ?", empresaID).
+			Where("administrador = true").
+			Where("aceptada_at IS NOT NULL").
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		if miembros > 0 && admins == 0 {
+			return errUltimoAdmin
+		}
+
+		// Sin miembros nadie puede gestionar las invitaciones que quedaron pendientes
+		if miembros == 0 {
+			_, err = tx.NewDelete().
+				Model((*models.EmpresaUsuario)(nil)).
+				Where("empresa_id = ?", empresaID).
+				Exec(ctx)
+		}
+		return err
+	})
+	if errors.Is(err, errEmpresaNoEncontrada) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "El usuario no pertenece a la empresa",
+		})
+		return
+	}
+	if errors.Is(err, errUltimoAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La empresa debe conservar al menos un administrador",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al quitar el usuario de la empresa",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Usuario quitado de la empresa",
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRegiones lista las regiones de Chile de norte a sur
+func GetRegiones(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    utils.Regiones(),
+	})
+}
+
+// GetComunas lista las comunas de una región; el id puede ser el código, el nombre o la abreviatura
+func GetComunas(c *gin.Context) {
+	region, ok := utils.FindRegion(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Región no encontrada",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    region.Comunas,
+	})
+}
+
+// resolveUbicacion valida la comuna contra el listado oficial. Si no se indica comuna se intenta
+// interpretar la ciudad como comuna. Devuelve nil sin error cuando no se indicó ninguna ubicación
+func resolveUbicacion(comuna, region, ciudad string) (*utils.Comuna, bool) {
+	valor := strings.TrimSpace(comuna)
+	if valor == "" {
+		valor = strings.TrimSpace(ciudad)
+	}
+	if valor == "" {
+		return nil, strings.TrimSpace(region) == ""
+	}
+	return utils.ResolveComuna(valor, region)
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// applyUbicacionUsuario normaliza la ubicación del usuario; responde 400 si la comuna no existe
+func applyUbicacionUsuario(c *gin.Context, user *models.Usuario, comuna, region, ciudad string) bool {
+	ubicacion, ok := resolveUbicacion(comuna, region, ciudad)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Comuna o región inválida; consulta GET /geo/regiones",
+		})
+		return false
+	}
+
+	if ubicacion == nil {
+		user.Ciudad, user.ComunaCodigo, user.RegionCodigo = "", "", ""
+		return true
+	}
+	user.Ciudad = ubicacion.Nombre
+	user.ComunaCodigo = ubicacion.Codigo
+	user.RegionCodigo = ubicacion.RegionCodigo
+	return true
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/db"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+// readinessTimeout limita lo que puede tardar /readyz para que el orquestador no acumule sondas
+const readinessTimeout = 3 * time.Second
+
+type HealthHandler struct {
+	db *bun.DB
+}
+
+func NewHealthHandler(db *bun.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// Liveness indica que el proceso está en ejecución; no consulta dependencias
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"status":  "ok",
+	})
+}
+
+// Readiness indica si la instancia puede recibir tráfico: la base de datos responde y no hay migraciones pendientes
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := h.db.PingContext(ctx); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "La base de datos no responde",
+			"checks":  gin.H{"database": "error"},
+		})
+		return
+	}
+
+	pendientes, err := db.PendingMigrations(ctx, h.db)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Error al consultar el estado de las migraciones",
+			"checks":  gin.H{"database": "ok", "migrations": "error"},
+		})
+		return
+	}
+	if len(pendientes) > 0 {
+		nombres := make([]string, 0, len(pendientes))
+		for _, m := range pendientes {
+			nombres = append(nombres, m.Name+"_"+m.Comment)
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Hay migraciones pendientes",
+			"checks":  gin.H{"database": "ok", "migrations": "pending"},
+			"data":    gin.H{"pendientes": nombres},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"status":  "ok",
+		"checks":  gin.H{"database": "ok", "migrations": "ok"},
+	})
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// invitacionTTL es la vigencia del enlace de activación; al reenviar la invitación se genera un enlace nuevo
+const invitacionTTL = 7 * 24 * time.Hour
+
+var errInvitacionInvalida = errors.New("invitación inválida")
+
+// InvitacionResponse estructura para la respuesta JSON de una invitación pendiente
+type InvitacionResponse struct {
+	ID          int       `json:"id"`
+	UsuarioID   int       `json:"usuario_id"`
+	Email       string    `json:"email"`
+	Nombre      string    `json:"nombre"`
+	Apellido    string    `json:"apellido"`
+	Rol         string    `json:"rol"`
+	InvitadoPor int       `json:"invitado_por"`
+	EnviadaAt   time.Time `json:"enviada_at"`
+	Envios      int       `json:"envios"`
+	ExpiraAt    time.Time `json:"expira_at"`
+	Expirada    bool      `json:"expirada"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// newInvitacion genera un token nuevo para la invitación; solo el hash queda en la base de datos
+func newInvitacion(usuarioID, invitadoPor int) (*models.Invitacion, string, error) {
+	token, hash, err := utils.GenerateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &models.Invitacion{
+		UsuarioID:   usuarioID,
+		InvitadoPor: invitadoPor,
+		TokenHash:   hash,
+		ExpiraAt:    now.Add(invitacionTTL),
+		EnviadaAt:   now,
+		Envios:      1,
+		CreatedAt:   now,
+	}, token, nil
+}
+
+// inviteUser crea el usuario sin contraseña y le envía el enlace de activación
+func (h *UserHandler) inviteUser(c *gin.Context, newUser *models.Usuario) {
+	var invitacion *models.Invitacion
+	var token string
+	err := h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(newUser).Exec(ctx); err != nil {
+			return err
+		}
+		var err error
+		invitacion, token, err = newInvitacion(newUser.ID, c.GetInt("userID"))
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(invitacion).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al crear la invitación",
+		})
+		return
+	}
+
+	// Si el envío falla la invitación queda pendiente y puede reenviarse
+	emailEnviado := true
+	if err := h.mailer.SendInvitationEmail(c, newUser.Email, newUser.Nombre, token, invitacion.ExpiraAt); err != nil {
+		slog.ErrorContext(c, "Error enviando email de invitación", "error", err)
+		emailEnviado = false
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Invitación creada exitosamente",
+		"data": gin.H{
+			"id":            newUser.ID,
+			"invitacion_id": invitacion.ID,
+			"email":         newUser.Email,
+			"expira_at":     invitacion.ExpiraAt,
+			"email_enviado": emailEnviado,
+		},
+	})
+}
+
+// GetInvitations lista las invitaciones pendientes (no aceptadas ni canceladas)
+func (h *UserHandler) GetInvitations(c *gin.Context) {
+	var invitaciones []models.Invitacion
+	err := h.db.NewSelect().
+		Model(&invitaciones).
+		Relation("Usuario").
+		Where("invitacion.aceptada_at IS NULL").
+		Where("invitacion.cancelada_at IS NULL").
+		OrderExpr("invitacion.enviada_at DESC").
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las invitaciones",
+		})
+		return
+	}
+
+	now := time.Now()
+	respuesta := make([]InvitacionResponse, 0, len(invitaciones))
+	for _, inv := range invitaciones {
+		// Los usuarios eliminados no se cargan en la relación
+		if inv.Usuario == nil || inv.Usuario.ID == 0 {
+			continue
+		}
+		respuesta = append(respuesta, InvitacionResponse{
+			ID:          inv.ID,
+			UsuarioID:   inv.UsuarioID,
+			Email:       inv.Usuario.Email,
+			Nombre:      inv.Usuario.Nombre,
+			Apellido:    inv.Usuario.Apellido,
+			Rol:         inv.Usuario.Rol,
+			InvitadoPor: inv.InvitadoPor,
+			EnviadaAt:   inv.EnviadaAt,
+			Envios:      inv.Envios,
+			ExpiraAt:    inv.ExpiraAt,
+			Expirada:    now.After(inv.ExpiraAt),
+			CreatedAt:   inv.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// getPendingInvitation obtiene una invitación pendiente por su ID con el usuario invitado
+func (h *UserHandler) getPendingInvitation(c *gin.Context) (*models.Invitacion, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de invitación inválido",
+		})
+		return nil, false
+	}
+
+	invitacion := new(models.Invitacion)
+	err = h.db.NewSelect().
+		Model(invitacion).
+		Relation("Usuario").
+		Where("invitacion.id = ?", id).
+		Where("invitacion.aceptada_at IS NULL").
+		Where("invitacion.cancelada_at IS NULL").
+		Scan(c)
+	if err != nil || invitacion.Usuario == nil || invitacion.Usuario.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Invitación pendiente no encontrada",
+		})
+		return nil, false
+	}
+	return invitacion, true
+}
+
+// ResendInvitation genera un enlace nuevo (el anterior deja de funcionar) y lo vuelve a enviar
+func (h *UserHandler) ResendInvitation(c *gin.Context) {
+	invitacion, ok := h.getPendingInvitation(c)
+	if !ok {
+		return
+	}
+
+	token, hash, err := utils.GenerateInvitationToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al generar la invitación",
+		})
+		return
+	}
+
+	now := time.Now()
+	invitacion.TokenHash = hash
+	invitacion.EnviadaAt = now
+	invitacion.ExpiraAt = now.Add(invitacionTTL)
+	invitacion.Envios++
+	_, err = h.db.NewUpdate().
+		Model(invitacion).
+		Column("token_hash", "enviada_at", "expira_at", "envios").
+		WherePK().
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la invitación",
+		})
+		return
+	}
+
+	if err := h.mailer.SendInvitationEmail(c, invitacion.Usuario.Email, invitacion.Usuario.Nombre, token, invitacion.ExpiraAt); err != nil {
+		slog.ErrorContext(c, "Error reenviando email de invitación", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al enviar el email de invitación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitación reenviada exitosamente",
+		"data": gin.H{
+			"expira_at": invitacion.ExpiraAt,
+		},
+	})
+}
+
+// CancelInvitation anula la invitación y elimina la cuenta pendiente para que el email pueda volver a usarse
+func (h *UserHandler) CancelInvitation(c *gin.Context) {
+	invitacion, ok := h.getPendingInvitation(c)
+	if !ok {
+		return
+	}
+
+	// La cuenta nunca se activó, por lo que se borra de verdad en vez de quedar eliminada lógicamente
+	// (y restaurable sin contraseña); la invitación se borra con ella por la clave foránea ON DELETE CASCADE
+	_, err := h.db.NewDelete().
+		Model((*models.Usuario)(nil)).
+		Where("id = ?", invitacion.UsuarioID).
+		ForceDelete().
+		Exec(c)
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		slog.ErrorContext(c, "Error cancelando la invitación", "invitacion_id", invitacion.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al cancelar la invitación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitación cancelada exitosamente",
+	})
+}
+
+// tieneInvitacionPendiente indica si el usuario fue invitado y todavía no activa su cuenta.
+// Esas cuentas solo se activan con el enlace de la invitación, no con el reseteo de contraseña
+func tieneInvitacionPendiente(ctx context.Context, db bun.IDB, usuarioID int) (bool, error) {
+	return db.NewSelect().
+		Model((*models.Invitacion)(nil)).
+		Where("usuario_id = ?", usuarioID).
+		Where("aceptada_at IS NULL").
+		Where("cancelada_at IS NULL").
+		Exists(ctx)
+}
+
+// findInvitationByToken busca una invitación vigente a partir del token del enlace
+func findInvitationByToken(ctx context.Context, db bun.IDB, token string) (*models.Invitacion, error) {
+	if token == "" {
+		return nil, errInvitacionInvalida
+	}
+	invitacion := new(models.Invitacion)
+	err := db.NewSelect().
+		Model(invitacion).
+		Relation("Usuario").
+		Where("invitacion.token_hash = ?", utils.HashInvitationToken(token)).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvitacionInvalida
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invitacion.AceptadaAt != nil || invitacion.CanceladaAt != nil || time.Now().After(invitacion.ExpiraAt) ||
+		invitacion.Usuario == nil || invitacion.Usuario.ID == 0 {
+		return nil, errInvitacionInvalida
+	}
+	return invitacion, nil
+}
+
+// GetInvitationByToken devuelve los datos del invitado para mostrarlos en la página de activación
+func (h *UserHandler) GetInvitationByToken(c *gin.Context) {
+	invitacion, err := findInvitationByToken(c, h.db, c.Query("token"))
+	if errors.Is(err, errInvitacionInvalida) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La invitación no es válida o ya expiró",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la invitación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"email":     invitacion.Usuario.Email,
+			"nombre":    invitacion.Usuario.Nombre,
+			"apellido":  invitacion.Usuario.Apellido,
+			"expira_at": invitacion.ExpiraAt,
+		},
+	})
+}
+
+// AcceptInvitation permite al invitado elegir su contraseña; el enlace queda usado y la cuenta verificada
+func (h *UserHandler) AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token y contraseña requeridos: " + err.Error(),
+		})
+		return
+	}
+
+	invitacion, err := findInvitationByToken(c, h.db, input.Token)
+	if errors.Is(err, errInvitacionInvalida) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La invitación no es válida o ya expiró",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la invitación",
+		})
+		return
+	}
+
+	usuario := invitacion.Usuario
+	if !checkPasswordPolicy(c, input.Password, utils.PasswordUser{Email: usuario.Email, Nombre: usuario.Nombre, Apellido: usuario.Apellido}) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al encriptar la contraseña",
+		})
+		return
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		// La condición sobre aceptada_at evita que el mismo enlace se use dos veces en paralelo
+		result, err := tx.NewUpdate().
+			Model((*models.Invitacion)(nil)).
+			Set("aceptada_at = ?", time.Now()).
+			Where("id = ?", invitacion.ID).
+			Where("aceptada_at IS NULL").
+			Where("cancelada_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errInvitacionInvalida
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.Usuario)(nil)).
+			Set("password = ?", string(hash)).
+			Set("verificado = true").
+			Set("updated_at = ?", time.Now()).
+			Where("id = ?", usuario.ID).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errInvitacionInvalida) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La invitación no es válida o ya expiró",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al activar la cuenta",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Cuenta activada exitosamente. Ya puedes iniciar sesión",
+	})
+}
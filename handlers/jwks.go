@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"cotizador-productos-eml/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *utils.JWTKeys
+}
+
+func NewJWKSHandler(keys *utils.JWTKeys) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS publica las claves públicas con las que otros servicios pueden validar nuestros access tokens
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": h.keys.PublicJWKS(),
+	})
+}
@@ -0,0 +1,657 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+const (
+	mfaTokenTTL         = 5 * time.Minute
+	mfaMaxIntentos      = 5
+	mfaBloqueo          = 15 * time.Minute
+	mfaRecoveryCodesNum = 10
+)
+
+// mfaRequiredFor indica si el rol está obligado a usar 2FA (configurable con MFA_REQUIRED_FOR_ADMIN)
+func (h *AuthHandler) mfaRequiredFor(rol string) bool {
+	return rol == "admin" && h.cfg.MFA.RequiredForAdmin
+}
+
+// getUsuarioMFA obtiene la configuración de 2FA del usuario, o nil si nunca la inició
+func getUsuarioMFA(ctx context.Context, db bun.IDB, userID int) (*models.UsuarioMFA, error) {
+	mfa := new(models.UsuarioMFA)
+	err := db.NewSelect().Model(mfa).Where("usuario_id = ?", userID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// errMFABloqueado indica que el usuario agotó los intentos de 2FA y está bloqueado temporalmente
+var errMFABloqueado = errors.New("2FA bloqueado temporalmente")
+
+// reservarIntentoMFA cuenta un intento de verificación antes de validar el código y devuelve el número de intento.
+// El incremento es atómico, por lo que peticiones en paralelo no pueden probar más de mfaMaxIntentos códigos
+func reservarIntentoMFA(ctx context.Context, db bun.IDB, userID int) (int, error) {
+	var intentos int
+	err := db.NewUpdate().
+		Model((*models.UsuarioMFA)(nil)).
+		Set("intentos = intentos + 1").
+		Where("usuario_id = ?", userID).
+		Where("intentos < ?", mfaMaxIntentos).
+		Where("bloqueado_hasta IS NULL OR bloqueado_hasta <= ?", time.Now()).
+		Returning("intentos").
+		Scan(ctx, &intentos)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errMFABloqueado
+	}
+	return intentos, err
+}
+
+// checkTOTP valida un código TOTP y registra el paso usado para que no pueda reutilizarse
+func checkTOTP(ctx context.Context, db bun.IDB, mfa *models.UsuarioMFA, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(mfa.Secreto, code, mfa.UltimoPaso, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// La condición sobre ultimo_paso evita que dos peticiones concurrentes usen el mismo código
+	result, err := db.NewUpdate().
+		Model((*models.UsuarioMFA)(nil)).
+		Set("ultimo_paso = ?", step).
+		Set("updated_at = ?", time.Now()).
+		Where("usuario_id = ?", mfa.UsuarioID).
+		Where("ultimo_paso < ?", step).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	mfa.UltimoPaso = step
+	return rowsAffected == 1, nil
+}
+
+// useRecoveryCode marca como usado un código de recuperación válido
+func useRecoveryCode(ctx context.Context, db bun.IDB, userID int, code string) (bool, error) {
+	result, err := db.NewUpdate().
+		Model((*models.CodigoRecuperacion)(nil)).
+		Set("usado_at = ?", time.Now()).
+		Where("usuario_id = ?", userID).
+		Where("codigo_hash = ?", utils.HashRecoveryCode(code)).
+		Where("usado_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// replaceRecoveryCodes reemplaza los códigos de recuperación del usuario y devuelve los nuevos en texto plano
+func replaceRecoveryCodes(ctx context.Context, db bun.IDB, userID int) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(mfaRecoveryCodesNum)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewDelete().
+		Model((*models.CodigoRecuperacion)(nil)).
+		Where("usuario_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	registros := make([]*models.CodigoRecuperacion, 0, len(codes))
+	for _, code := range codes {
+		registros = append(registros, &models.CodigoRecuperacion{
+			UsuarioID:  userID,
+			CodigoHash: utils.HashRecoveryCode(code),
+			CreatedAt:  now,
+		})
+	}
+	if _, err := db.NewInsert().Model(&registros).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// respondMFAChallenge emite un token de corta duración en lugar de los tokens de sesión
+func (h *AuthHandler) respondMFAChallenge(c *gin.Context, usuario models.Usuario, tokenType string) {
+	var mfaToken string
+	var err error
+	if tokenType == "mfa_pending" {
+		mfaToken, err = h.issueMFAPendingToken(c, usuario)
+	} else {
+		mfaToken, err = h.keys.GenerateJWT(
+			usuario.ID,
+			usuario.Email,
+			usuario.Rol,
+			mfaTokenTTL,
+			tokenType,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando token de 2FA",
+		})
+		return
+	}
+
+	if tokenType == "mfa_enroll" {
+		c.JSON(http.StatusOK, gin.H{
+			"success":                 true,
+			"message":                 "Debes configurar la autenticación de dos factores para continuar",
+			"mfa_enrollment_required": true,
+			"mfa_token":               mfaToken,
+			"expires_in":              int(mfaTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Ingresa el código de tu aplicación autenticadora",
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(mfaTokenTTL.Seconds()),
+	})
+}
+
+// issueMFAPendingToken genera el token mfa_pending y guarda su jti; cualquier token emitido antes deja de ser válido
+func (h *AuthHandler) issueMFAPendingToken(ctx context.Context, usuario models.Usuario) (string, error) {
+	token, jti, err := h.keys.GenerateMFAPendingJWT(usuario.ID, usuario.Email, usuario.Rol, mfaTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.db.NewUpdate().
+		Model((*models.UsuarioMFA)(nil)).
+		Set("token_jti = ?", jti).
+		Where("usuario_id = ?", usuario.ID).
+		Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyMFA completa el inicio de sesión validando el código TOTP o un código de recuperación
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	if input.Code == "" && input.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Se requiere un código de verificación o de recuperación",
+		})
+		return
+	}
+
+	claims, err := h.keys.ParseJWT(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	if tokenType, ok := claims["type"].(string); !ok || tokenType != "mfa_pending" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Tipo de token inválido",
+		})
+		return
+	}
+
+	userID, ok := claims["sub"].(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	var usuario models.Usuario
+	err = h.db.NewSelect().
+		Model(&usuario).
+		Where("id = ?", int(userID)).
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	mfa, err := getUsuarioMFA(c, h.db, usuario.ID)
+	if err != nil || mfa == nil || !mfa.Habilitado {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores no está habilitada",
+		})
+		return
+	}
+
+	// Solo sirve el último token emitido y una única vez
+	if mfa.TokenJTI != jti {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	// Bloquear temporalmente tras varios intentos fallidos
+	intentos, err := reservarIntentoMFA(c, h.db, usuario.ID)
+	if errors.Is(err, errMFABloqueado) {
+		utils.RecordLoginFallido(utils.LoginFalloMFABloqueado)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"error":   "Demasiados intentos fallidos, intenta nuevamente más tarde",
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c, "Error registrando intento de 2FA", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar el código",
+		})
+		return
+	}
+
+	var valido bool
+	if input.Code != "" {
+		valido, err = checkTOTP(c, h.db, mfa, input.Code)
+	} else {
+		valido, err = useRecoveryCode(c, h.db, usuario.ID, input.RecoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar el código",
+		})
+		return
+	}
+
+	if !valido {
+		// El intento ya se contó; al agotar los intentos se bloquea y el contador vuelve a cero
+		if intentos >= mfaMaxIntentos {
+			_, err := h.db.NewUpdate().
+				Model((*models.UsuarioMFA)(nil)).
+				Set("intentos = 0").
+				Set("bloqueado_hasta = ?", time.Now().Add(mfaBloqueo)).
+				Where("usuario_id = ?", usuario.ID).
+				Exec(c)
+			if err != nil {
+				slog.ErrorContext(c, "Error bloqueando 2FA tras intentos fallidos", "error", err)
+			}
+		}
+		utils.RecordLoginFallido(utils.LoginFalloMFA)
+
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Código inválido",
+		})
+		return
+	}
+
+	// Consumir el token de forma atómica: si otra petición ya lo usó, esta no inicia sesión
+	res, err := h.db.NewUpdate().
+		Model((*models.UsuarioMFA)(nil)).
+		Set("intentos = 0").
+		Set("bloqueado_hasta = NULL").
+		Set("token_jti = NULL").
+		Where("usuario_id = ?", usuario.ID).
+		Where("token_jti = ?", jti).
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la configuración de 2FA",
+		})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	h.completeLogin(c, usuario)
+}
+
+// EnrollMFA inicia la configuración de 2FA y devuelve la URI otpauth para la app autenticadora
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	userID := c.GetInt("userID")
+	email := c.GetString("email")
+
+	mfa, err := getUsuarioMFA(c, h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la configuración de 2FA",
+		})
+		return
+	}
+	if mfa != nil && mfa.Habilitado {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores ya está habilitada",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando el secreto de 2FA",
+		})
+		return
+	}
+
+	// Cada inscripción reemplaza el secreto pendiente anterior
+	now := time.Now()
+	registro := &models.UsuarioMFA{
+		UsuarioID:  userID,
+		Secreto:    secret,
+		Habilitado: false,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	_, err = h.db.NewInsert().
+		Model(registro).
+		On("CONFLICT (usuario_id) DO UPDATE").
+		Set("secreto = EXCLUDED.secreto").
+		Set("habilitado = false").
+		Set("ultimo_paso = 0").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al guardar la configuración de 2FA",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Escanea el código con tu aplicación autenticadora y confirma con un código",
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPAuthURI(secret, h.cfg.MFA.Issuer, email),
+		},
+	})
+}
+
+// ConfirmMFA activa 2FA tras validar el primer código y entrega los códigos de recuperación
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código requerido: " + err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al iniciar transacción",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	mfa, err := getUsuarioMFA(c, tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener la configuración de 2FA",
+		})
+		return
+	}
+	if mfa == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Primero debes iniciar la configuración de 2FA",
+		})
+		return
+	}
+	if mfa.Habilitado {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores ya está habilitada",
+		})
+		return
+	}
+
+	valido, err := checkTOTP(c, tx, mfa, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al verificar el código",
+		})
+		return
+	}
+	if !valido {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código inválido",
+		})
+		return
+	}
+
+	now := time.Now()
+	_, err = tx.NewUpdate().
+		Model((*models.UsuarioMFA)(nil)).
+		Set("habilitado = true").
+		Set("confirmado_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("usuario_id = ?", userID).
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al habilitar 2FA",
+		})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(c, tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando códigos de recuperación",
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al confirmar transacción",
+		})
+		return
+	}
+
+	message := "Autenticación de dos factores habilitada. Guarda tus códigos de recuperación en un lugar seguro"
+	if c.GetString("tokenType") == "mfa_enroll" {
+		message += ". Inicia sesión nuevamente para continuar"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableMFA deshabilita 2FA previa validación de un código vigente
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	if h.mfaRequiredFor(c.GetString("rol")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores es obligatoria para tu rol",
+		})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código requerido: " + err.Error(),
+		})
+		return
+	}
+
+	mfa, err := getUsuarioMFA(c, h.db, userID)
+	if err != nil || mfa == nil || !mfa.Habilitado {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores no está habilitada",
+		})
+		return
+	}
+
+	valido, err := checkTOTP(c, h.db, mfa, input.Code)
+	if err != nil || !valido {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código inválido",
+		})
+		return
+	}
+
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*models.CodigoRecuperacion)(nil)).Where("usuario_id = ?", userID).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewDelete().Model((*models.UsuarioMFA)(nil)).Where("usuario_id = ?", userID).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al deshabilitar 2FA",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Autenticación de dos factores deshabilitada",
+	})
+}
+
+// RegenerateRecoveryCodes invalida los códigos de recuperación anteriores y genera nuevos
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código requerido: " + err.Error(),
+		})
+		return
+	}
+
+	mfa, err := getUsuarioMFA(c, h.db, userID)
+	if err != nil || mfa == nil || !mfa.Habilitado {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La autenticación de dos factores no está habilitada",
+		})
+		return
+	}
+
+	valido, err := checkTOTP(c, h.db, mfa, input.Code)
+	if err != nil || !valido {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Código inválido",
+		})
+		return
+	}
+
+	var codes []string
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando códigos de recuperación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Códigos de recuperación regenerados",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"cotizador-productos-eml/models"
 	"cotizador-productos-eml/utils"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,13 +28,18 @@ func NewOrderHandler(db *bun.DB) *OrderHandler {
 
 // CreateOrderRequest estructura para recibir la solicitud de creación de pedido
 type CreateOrderRequest struct {
+	DireccionID      *int                 `json:"direccion_id"` // Dirección guardada; reemplaza los campos de destino
 	CiudadDestino    string               `json:"ciudad_destino"`
+	RegionDestino    string               `json:"region_destino"` // Código, nombre o abreviatura de la región
+	ComunaDestino    string               `json:"comuna_destino"` // Código o nombre de la comuna; si se omite se usa la ciudad
 	DireccionDestino string               `json:"direccion_destino"`
-	RutDestinatario  string               `json:"rut_destinatario" binding:"required"`
+	RutDestinatario  string               `json:"rut_destinatario"`
+	TelefonoDestino  string               `json:"telefono_destino"`
 	Company          string               `json:"company"`
 	TipoEnvio        string               `json:"tipo_envio" binding:"required"`
 	MetodoPago       string               `json:"metodo_pago" binding:"required"`
 	TipoDocumento    string               `json:"tipo_documento" binding:"required"`
+	EmpresaID        *int                 `json:"empresa_id"` // Empresa a la que se emite la factura
 	Items            []CreateOrderItemDTO `json:"items" binding:"required,dive"`
 }
 
@@ -43,59 +51,163 @@ type CreateOrderItemDTO struct {
 
 // PedidoResponse estructura para la respuesta JSON sin incluir el campo Usuario
 type PedidoResponse struct {
-	ID               int        `json:"id"`
-	UsuarioId        int        `json:"usuario_id"`
-	Total            int        `json:"total"`
-	Estado           string     `json:"estado"`
-	FechaEnvio       *time.Time `json:"fecha_envio,omitempty"`
-	CiudadDestino    string     `json:"ciudad_destino"`
-	DireccionDestino string     `json:"direccion_destino"`
-	RutDestinatario  string     `json:"rut_destinatario"`
-	Company          string     `json:"company"`
-	TipoEnvio        string     `json:"tipo_envio"`
-	MetodoPago       string     `json:"metodo_pago"`
-	TipoDocumento    string     `json:"tipo_documento"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
+	ID               int                  `json:"id"`
+	UsuarioId        int                  `json:"usuario_id"`
+	Total            int                  `json:"total"`
+	Estado           string               `json:"estado"`
+	FechaEnvio       *time.Time           `json:"fecha_envio,omitempty"`
+	CiudadDestino    string               `json:"ciudad_destino"`
+	RegionDestino    string               `json:"region_destino"`
+	ComunaDestino    string               `json:"comuna_destino"`
+	DireccionDestino string               `json:"direccion_destino"`
+	RutDestinatario  string               `json:"rut_destinatario"`
+	TelefonoDestino  string               `json:"telefono_destino"`
+	Company          string               `json:"company"`
+	TipoEnvio        string               `json:"tipo_envio"`
+	MetodoPago       string               `json:"metodo_pago"`
+	TipoDocumento    string               `json:"tipo_documento"`
+	Facturacion      *FacturacionResponse `json:"facturacion,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
+}
+
+func newPedidoResponse(pedido *models.Pedido) PedidoResponse {
+	return PedidoResponse{
+		ID:               pedido.ID,
+		UsuarioId:        pedido.UsuarioId,
+		Total:            pedido.Total,
+		Estado:           pedido.Estado,
+		FechaEnvio:       pedido.FechaEnvio,
+		CiudadDestino:    pedido.CiudadDestino,
+		RegionDestino:    pedido.RegionDestino,
+		ComunaDestino:    pedido.ComunaDestino,
+		DireccionDestino: pedido.DireccionDestino,
+		RutDestinatario:  pedido.RutDestinatario,
+		TelefonoDestino:  pedido.TelefonoDestino,
+		Company:          pedido.Company,
+		TipoEnvio:        pedido.TipoEnvio,
+		MetodoPago:       pedido.MetodoPago,
+		TipoDocumento:    pedido.TipoDocumento,
+		Facturacion:      newFacturacionResponse(pedido),
+		CreatedAt:        pedido.CreatedAt,
+		UpdatedAt:        pedido.UpdatedAt,
+	}
+}
+
+// FacturacionResponse datos de facturación copiados en el pedido
+type FacturacionResponse struct {
+	EmpresaID           *int   `json:"empresa_id"`
+	RazonSocial         string `json:"razon_social"`
+	Rut                 string `json:"rut"`
+	Giro                string `json:"giro"`
+	DireccionTributaria string `json:"direccion_tributaria"`
+}
+
+func newFacturacionResponse(pedido *models.Pedido) *FacturacionResponse {
+	if pedido.FacturaRut == "" {
+		return nil
+	}
+	return &FacturacionResponse{
+		EmpresaID:           pedido.EmpresaID,
+		RazonSocial:         pedido.FacturaRazonSocial,
+		Rut:                 pedido.FacturaRut,
+		Giro:                pedido.FacturaGiro,
+		DireccionTributaria: pedido.FacturaDireccionTributaria,
+	}
 }
 
 // CreateOrder maneja la creación de un nuevo pedido
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	// Obtener token de las cookies
-	accessToken, err := c.Cookie("access_token")
-	if err != nil || accessToken == "" {
+	// Obtener ID del usuario del contexto (establecido por AuthMiddleware)
+	userID, exists := c.Get("userID")
+	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"error":   "No autenticado",
+			"error":   "No se encontró información del usuario",
 		})
 		return
 	}
 
-	// Verificar y extraer datos del token
-	claims, err := utils.ParseJWT(accessToken, os.Getenv("JWT_SECRET"))
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"success": false,
-			"error":   "Token inválido o expirado",
-		})
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Extraer ID de usuario del token
-	userID, ok := claims["sub"].(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"success": false,
-			"error":   "Token inválido (ID de usuario no encontrado)",
-		})
+	// Si se indicó una dirección guardada, se copian sus datos al pedido
+	if req.DireccionID != nil {
+		direccion := new(models.Direccion)
+		err := h.db.NewSelect().
+			Model(direccion).
+			Where("id = ?", *req.DireccionID).
+			Where("usuario_id = ?", userID.(int)).
+			Scan(c)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dirección guardada no encontrada"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c, "Error obteniendo la dirección guardada", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la dirección guardada"})
+			return
+		}
+		req.CiudadDestino = direccion.Ciudad
+		req.RegionDestino = direccion.RegionCodigo
+		req.ComunaDestino = direccion.ComunaCodigo
+		if req.ComunaDestino == "" {
+			req.ComunaDestino = direccion.Comuna
+		}
+		req.DireccionDestino = direccion.Direccion + ", " + direccion.Comuna
+		req.RutDestinatario = direccion.Rut
+		req.TelefonoDestino = direccion.Telefono
+	}
+
+	if req.RutDestinatario == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El RUT del destinatario es requerido"})
 		return
 	}
 
-	var req CreateOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// La comuna de destino se valida contra el listado oficial y se guarda con su código
+	usaCiudadComoComuna := strings.TrimSpace(req.ComunaDestino) == ""
+	ubicacion, ok := resolveUbicacion(req.ComunaDestino, req.RegionDestino, req.CiudadDestino)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comuna o región de destino inválida; consulta GET /geo/regiones"})
 		return
 	}
+	if ubicacion != nil {
+		req.ComunaDestino = ubicacion.Codigo
+		req.RegionDestino = ubicacion.RegionCodigo
+		if usaCiudadComoComuna || strings.TrimSpace(req.CiudadDestino) == "" {
+			req.CiudadDestino = ubicacion.Nombre
+		}
+	}
+
+	// Las facturas se emiten a una empresa del usuario con sus datos de facturación completos
+	var empresa *models.Empresa
+	if strings.EqualFold(req.TipoDocumento, tipoDocumentoFactura) {
+		if req.EmpresaID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Debes indicar la empresa (empresa_id) para emitir una factura"})
+			return
+		}
+		miembro, err := getEmpresaDeUsuario(c, h.db, *req.EmpresaID, userID.(int))
+		if errors.Is(err, errEmpresaNoEncontrada) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Empresa no encontrada"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c, "Error obteniendo la empresa del pedido", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la empresa"})
+			return
+		}
+		if faltantes := camposFacturacionFaltantes(miembro.Empresa); len(faltantes) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Los datos de facturación de la empresa están incompletos",
+				"faltantes": faltantes,
+			})
+			return
+		}
+		empresa = miembro.Empresa
+	}
 
 	// Validar campos según el tipo de envío
 	if req.TipoEnvio == "estandar" {
@@ -135,6 +247,12 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			return
 		}
 
+		// Los productos archivados no pueden agregarse a pedidos nuevos
+		if producto.ArchivadoAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El producto " + producto.Nombre + " ya no está disponible"})
+			return
+		}
+
 		// Calcular subtotal
 		subtotal := producto.PrecioVenta * item.Cantidad
 		total += subtotal
@@ -142,6 +260,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		// Crear detalle
 		detalle := &models.DetallePedido{
 			ProductoID:     item.ProductoID,
+			NombreProducto: producto.Nombre,
 			Cantidad:       item.Cantidad,
 			PrecioUnitario: producto.PrecioVenta,
 			PrecioTotal:    subtotal,
@@ -154,12 +273,15 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	// Crear pedido
 	pedido := &models.Pedido{
-		UsuarioId:        int(userID), // Usar el ID obtenido del token
+		UsuarioId:        userID.(int), // Usar el ID obtenido del token
 		Total:            total,
 		Estado:           "pendiente",
 		CiudadDestino:    req.CiudadDestino,
+		RegionDestino:    req.RegionDestino,
+		ComunaDestino:    req.ComunaDestino,
 		DireccionDestino: req.DireccionDestino,
 		RutDestinatario:  req.RutDestinatario,
+		TelefonoDestino:  req.TelefonoDestino,
 		Company:          req.Company,
 		TipoEnvio:        req.TipoEnvio,
 		MetodoPago:       req.MetodoPago,
@@ -168,9 +290,16 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		UpdatedAt:        now,
 	}
 
+	if empresa != nil {
+		snapshotFacturacion(pedido, empresa)
+	}
+
 	// Insertar pedido
 	_, err = tx.NewInsert().Model(pedido).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear pedido: " + err.Error()})
 		return
 	}
@@ -183,6 +312,9 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	// Insertar detalles
 	_, err = tx.NewInsert().Model(&detalles).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear detalles: " + err.Error()})
 		return
 	}
@@ -193,23 +325,10 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	utils.RecordPedidoCreado(pedido.Estado)
+
 	// Crear respuesta sin incluir el campo Usuario
-	respuesta := PedidoResponse{
-		ID:               pedido.ID,
-		UsuarioId:        pedido.UsuarioId,
-		Total:            pedido.Total,
-		Estado:           pedido.Estado,
-		FechaEnvio:       pedido.FechaEnvio,
-		CiudadDestino:    pedido.CiudadDestino,
-		DireccionDestino: pedido.DireccionDestino,
-		RutDestinatario:  pedido.RutDestinatario,
-		Company:          pedido.Company,
-		TipoEnvio:        pedido.TipoEnvio,
-		MetodoPago:       pedido.MetodoPago,
-		TipoDocumento:    pedido.TipoDocumento,
-		CreatedAt:        pedido.CreatedAt,
-		UpdatedAt:        pedido.UpdatedAt,
-	}
+	respuesta := newPedidoResponse(pedido)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -264,22 +383,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	// Convertir a respuesta sin el campo Usuario
 	respuesta := make([]PedidoResponse, 0, len(pedidos))
 	for _, pedido := range pedidos {
-		respuesta = append(respuesta, PedidoResponse{
-			ID:               pedido.ID,
-			UsuarioId:        pedido.UsuarioId,
-			Total:            pedido.Total,
-			Estado:           pedido.Estado,
-			FechaEnvio:       pedido.FechaEnvio,
-			CiudadDestino:    pedido.CiudadDestino,
-			DireccionDestino: pedido.DireccionDestino,
-			RutDestinatario:  pedido.RutDestinatario,
-			Company:          pedido.Company,
-			TipoEnvio:        pedido.TipoEnvio,
-			MetodoPago:       pedido.MetodoPago,
-			TipoDocumento:    pedido.TipoDocumento,
-			CreatedAt:        pedido.CreatedAt,
-			UpdatedAt:        pedido.UpdatedAt,
-		})
+		respuesta = append(respuesta, newPedidoResponse(&pedido))
 	}
 
 	// Calcular datos de paginación
@@ -333,22 +437,7 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 	// Convertir a respuesta sin el campo Usuario
 	respuesta := make([]PedidoResponse, 0, len(pedidos))
 	for _, pedido := range pedidos {
-		respuesta = append(respuesta, PedidoResponse{
-			ID:               pedido.ID,
-			UsuarioId:        pedido.UsuarioId,
-			Total:            pedido.Total,
-			Estado:           pedido.Estado,
-			FechaEnvio:       pedido.FechaEnvio,
-			CiudadDestino:    pedido.CiudadDestino,
-			DireccionDestino: pedido.DireccionDestino,
-			RutDestinatario:  pedido.RutDestinatario,
-			Company:          pedido.Company,
-			TipoEnvio:        pedido.TipoEnvio,
-			MetodoPago:       pedido.MetodoPago,
-			TipoDocumento:    pedido.TipoDocumento,
-			CreatedAt:        pedido.CreatedAt,
-			UpdatedAt:        pedido.UpdatedAt,
-		})
+		respuesta = append(respuesta, newPedidoResponse(&pedido))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -367,6 +456,23 @@ type DetallePedidoResponse struct {
 	PrecioTotal    int    `json:"precio_total"`
 }
 
+func newDetallePedidoResponse(detalle models.DetallePedido) DetallePedidoResponse {
+	// Usar el nombre guardado en la línea; el del producto solo para líneas antiguas sin snapshot
+	nombreProducto := detalle.NombreProducto
+	if nombreProducto == "" && detalle.Producto != nil {
+		nombreProducto = detalle.Producto.Nombre
+	}
+
+	return DetallePedidoResponse{
+		ID:             detalle.ID,
+		ProductoID:     detalle.ProductoID,
+		Nombre:         nombreProducto,
+		Cantidad:       detalle.Cantidad,
+		PrecioUnitario: detalle.PrecioUnitario,
+		PrecioTotal:    detalle.PrecioTotal,
+	}
+}
+
 // PedidoDetalladoResponse estructura para la respuesta con los detalles completos
 type PedidoDetalladoResponse struct {
 	Pedido   PedidoResponse          `json:"pedido"`
@@ -421,8 +527,9 @@ func (h *OrderHandler) GetOrderDetail(c *gin.Context) {
 	}
 
 	// Verificar que el usuario tenga permiso para ver este pedido
-	// Si no es admin, solo puede ver sus propios pedidos
-	if rol != "admin" && pedido.UsuarioId != userID {
+	// Si no tiene orders:read_all, solo puede ver sus propios pedidos
+	rolStr, _ := rol.(string)
+	if !utils.HasPermission(rolStr, utils.PermOrdersReadAll) && pedido.UsuarioId != userID {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"error":   "No tienes permiso para ver este pedido",
@@ -448,19 +555,7 @@ func (h *OrderHandler) GetOrderDetail(c *gin.Context) {
 	// Crear respuesta solo con detalles
 	detallesResponse := make([]DetallePedidoResponse, 0, len(detalles))
 	for _, detalle := range detalles {
-		nombreProducto := ""
-		if detalle.Producto != nil {
-			nombreProducto = detalle.Producto.Nombre
-		}
-
-		detallesResponse = append(detallesResponse, DetallePedidoResponse{
-			ID:             detalle.ID,
-			ProductoID:     detalle.ProductoID,
-			Nombre:         nombreProducto,
-			Cantidad:       detalle.Cantidad,
-			PrecioUnitario: detalle.PrecioUnitario,
-			PrecioTotal:    detalle.PrecioTotal,
-		})
+		detallesResponse = append(detallesResponse, newDetallePedidoResponse(detalle))
 	}
 
 	// Respuesta final solo con los detalles
@@ -475,15 +570,25 @@ type UpdateOrderAdminRequest struct {
 	Estado           string                   `json:"estado"`
 	FechaEnvio       *time.Time               `json:"fecha_envio"`
 	CiudadDestino    string                   `json:"ciudad_destino"`
+	RegionDestino    string                   `json:"region_destino"`
+	ComunaDestino    string                   `json:"comuna_destino"`
 	DireccionDestino string                   `json:"direccion_destino"`
 	RutDestinatario  string                   `json:"rut_destinatario"`
 	Company          string                   `json:"company"`
 	TipoEnvio        string                   `json:"tipo_envio"`
 	MetodoPago       string                   `json:"metodo_pago"`
 	TipoDocumento    string                   `json:"tipo_documento"`
+	EmpresaID        *int                     `json:"empresa_id"`
 	Items            []UpdateOrderItemRequest `json:"items"`
 }
 
+// soloEstado indica si la solicitud solo modifica el estado y la fecha de envío
+func (r UpdateOrderAdminRequest) soloEstado() bool {
+	return r.CiudadDestino == "" && r.RegionDestino == "" && r.ComunaDestino == "" && r.DireccionDestino == "" && r.RutDestinatario == "" &&
+		r.Company == "" && r.TipoEnvio == "" && r.MetodoPago == "" && r.TipoDocumento == "" &&
+		r.EmpresaID == nil && len(r.Items) == 0
+}
+
 // estructura para recibir la solicitud de actualización de productos por un cliente
 type UpdateOrderClientRequest struct {
 	Items []UpdateOrderItemRequest `json:"items" binding:"required,dive"`
@@ -499,16 +604,6 @@ type UpdateOrderItemRequest struct {
 
 // UpdateOrderAdmin permite a un administrador actualizar cualquier pedido y sus detalles
 func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
-	// Verificar que el usuario sea admin
-	rol, exists := c.Get("rol")
-	if !exists || rol != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "No tienes permisos para realizar esta acción",
-		})
-		return
-	}
-
 	// Obtener ID del pedido de los parámetros de consulta
 	pedidoIDStr := c.Query("id")
 	pedidoID, err := strconv.Atoi(pedidoIDStr)
@@ -530,6 +625,15 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 		return
 	}
 
+	// Sin orders:update solo se permite cambiar el estado y la fecha de envío
+	if !utils.HasPermission(c.GetString("rol"), utils.PermOrdersUpdate) && !req.soloEstado() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Solo tienes permisos para cambiar el estado y la fecha de envío del pedido",
+		})
+		return
+	}
+
 	// Iniciar transacción
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -561,6 +665,7 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 	pedido.UpdatedAt = time.Now()
 
 	// Verificar si se actualizará el estado
+	estadoAnterior := pedido.Estado
 	if req.Estado != "" {
 		pedido.Estado = req.Estado
 		fieldsToUpdate = append(fieldsToUpdate, "estado")
@@ -572,10 +677,24 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 		fieldsToUpdate = append(fieldsToUpdate, "fecha_envio")
 	}
 
-	// Verificar si se actualizará la ciudad de destino
-	if req.CiudadDestino != "" {
-		pedido.CiudadDestino = req.CiudadDestino
-		fieldsToUpdate = append(fieldsToUpdate, "ciudad_destino")
+	// Verificar si se actualizará el destino; la comuna se valida igual que al crear el pedido
+	if req.CiudadDestino != "" || req.ComunaDestino != "" || req.RegionDestino != "" {
+		ubicacion, ok := resolveUbicacion(req.ComunaDestino, req.RegionDestino, req.CiudadDestino)
+		if !ok || ubicacion == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Comuna o región de destino inválida; consulta GET /geo/regiones",
+			})
+			return
+		}
+		if req.CiudadDestino != "" && req.ComunaDestino != "" {
+			pedido.CiudadDestino = req.CiudadDestino
+		} else {
+			pedido.CiudadDestino = ubicacion.Nombre
+		}
+		pedido.ComunaDestino = ubicacion.Codigo
+		pedido.RegionDestino = ubicacion.RegionCodigo
+		fieldsToUpdate = append(fieldsToUpdate, "ciudad_destino", "comuna_destino", "region_destino")
 	}
 
 	// Verificar si se actualizará la dirección de destino
@@ -630,9 +749,51 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 		fieldsToUpdate = append(fieldsToUpdate, "tipo_documento")
 	}
 
+	// Verificar si se cambiará la empresa de facturación; debe ser una empresa del cliente
+	if req.EmpresaID != nil {
+		miembro, err := getEmpresaDeUsuario(c, tx, *req.EmpresaID, pedido.UsuarioId)
+		if errors.Is(err, errEmpresaNoEncontrada) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "La empresa no pertenece al cliente del pedido",
+			})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c, "Error obteniendo la empresa del pedido", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Error al obtener la empresa",
+			})
+			return
+		}
+		if faltantes := camposFacturacionFaltantes(miembro.Empresa); len(faltantes) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":   false,
+				"error":     "Los datos de facturación de la empresa están incompletos",
+				"faltantes": faltantes,
+			})
+			return
+		}
+		snapshotFacturacion(pedido, miembro.Empresa)
+		fieldsToUpdate = append(fieldsToUpdate, "empresa_id", "factura_razon_social", "factura_rut", "factura_giro", "factura_direccion_tributaria")
+	}
+
+	// Los pedidos antiguos con factura sin empresa se mantienen hasta que se cambie el tipo de documento
+	if req.TipoDocumento != "" && strings.EqualFold(pedido.TipoDocumento, tipoDocumentoFactura) && pedido.FacturaRut == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Debes indicar la empresa (empresa_id) para emitir una factura",
+		})
+		return
+	}
+
 	// Actualizar el pedido en la base de datos solo con los campos especificados
 	_, err = update.Column(fieldsToUpdate...).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error al actualizar pedido: " + err.Error(),
@@ -705,11 +866,21 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 					return
 				}
 
+				// Solo se puede cambiar a un producto archivado si la línea ya lo tenía
+				if producto.ArchivadoAt != nil && item.ProductoID != detalle.ProductoID {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"success": false,
+						"error":   "El producto " + producto.Nombre + " ya no está disponible",
+					})
+					return
+				}
+
 				// Calcular nuevo precio total
 				precioTotal := producto.PrecioVenta * item.Cantidad
 
 				// Actualizar el detalle
 				detalle.ProductoID = item.ProductoID
+				detalle.NombreProducto = producto.Nombre
 				detalle.Cantidad = item.Cantidad
 				detalle.PrecioUnitario = producto.PrecioVenta
 				detalle.PrecioTotal = precioTotal
@@ -731,6 +902,15 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 					return
 				}
 
+				// Los productos archivados no pueden agregarse a pedidos
+				if producto.ArchivadoAt != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"success": false,
+						"error":   "El producto " + producto.Nombre + " ya no está disponible",
+					})
+					return
+				}
+
 				// Calcular precio total
 				precioTotal := producto.PrecioVenta * item.Cantidad
 
@@ -738,6 +918,7 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 				detalle := &models.DetallePedido{
 					PedidoID:       pedidoID,
 					ProductoID:     item.ProductoID,
+					NombreProducto: producto.Nombre,
 					Cantidad:       item.Cantidad,
 					PrecioUnitario: producto.PrecioVenta,
 					PrecioTotal:    precioTotal,
@@ -794,6 +975,9 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 				Model(&detallesNuevos).
 				Exec(c)
 			if err != nil {
+				if respondConstraintError(c, err) {
+					return
+				}
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"success": false,
 					"error":   "Error al insertar nuevos detalles: " + err.Error(),
@@ -827,6 +1011,10 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 		return
 	}
 
+	if req.Estado != "" && req.Estado != estadoAnterior {
+		utils.RecordCambioEstadoPedido(req.Estado)
+	}
+
 	// Obtener el pedido actualizado para la respuesta
 	pedidoActualizado := new(models.Pedido)
 	err = h.db.NewSelect().
@@ -842,22 +1030,7 @@ func (h *OrderHandler) UpdateOrderAdmin(c *gin.Context) {
 	}
 
 	// Crear respuesta
-	respuesta := PedidoResponse{
-		ID:               pedidoActualizado.ID,
-		UsuarioId:        pedidoActualizado.UsuarioId,
-		Total:            pedidoActualizado.Total,
-		Estado:           pedidoActualizado.Estado,
-		FechaEnvio:       pedidoActualizado.FechaEnvio,
-		CiudadDestino:    pedidoActualizado.CiudadDestino,
-		DireccionDestino: pedidoActualizado.DireccionDestino,
-		RutDestinatario:  pedidoActualizado.RutDestinatario,
-		Company:          pedidoActualizado.Company,
-		TipoEnvio:        pedidoActualizado.TipoEnvio,
-		MetodoPago:       pedidoActualizado.MetodoPago,
-		TipoDocumento:    pedidoActualizado.TipoDocumento,
-		CreatedAt:        pedidoActualizado.CreatedAt,
-		UpdatedAt:        pedidoActualizado.UpdatedAt,
-	}
+	respuesta := newPedidoResponse(pedidoActualizado)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1003,11 +1176,21 @@ func (h *OrderHandler) UpdateOrderClient(c *gin.Context) {
 				return
 			}
 
+			// Solo se puede cambiar a un producto archivado si la línea ya lo tenía
+			if producto.ArchivadoAt != nil && item.ProductoID != detalle.ProductoID {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   "El producto " + producto.Nombre + " ya no está disponible",
+				})
+				return
+			}
+
 			// Calcular nuevo precio total
 			precioTotal := producto.PrecioVenta * item.Cantidad
 
 			// Actualizar el detalle
 			detalle.ProductoID = item.ProductoID
+			detalle.NombreProducto = producto.Nombre
 			detalle.Cantidad = item.Cantidad
 			detalle.PrecioUnitario = producto.PrecioVenta
 			detalle.PrecioTotal = precioTotal
@@ -1029,6 +1212,15 @@ func (h *OrderHandler) UpdateOrderClient(c *gin.Context) {
 				return
 			}
 
+			// Los productos archivados no pueden agregarse a pedidos
+			if producto.ArchivadoAt != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   "El producto " + producto.Nombre + " ya no está disponible",
+				})
+				return
+			}
+
 			// Verificar que el producto esté disponible
 			if !producto.Disponible {
 				c.JSON(http.StatusBadRequest, gin.H{
@@ -1045,6 +1237,7 @@ func (h *OrderHandler) UpdateOrderClient(c *gin.Context) {
 			detalle := &models.DetallePedido{
 				PedidoID:       pedidoID,
 				ProductoID:     item.ProductoID,
+				NombreProducto: producto.Nombre,
 				Cantidad:       item.Cantidad,
 				PrecioUnitario: producto.PrecioVenta,
 				PrecioTotal:    precioTotal,
@@ -1101,6 +1294,9 @@ func (h *OrderHandler) UpdateOrderClient(c *gin.Context) {
 			Model(&detallesNuevos).
 			Exec(c)
 		if err != nil {
+			if respondConstraintError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"error":   "Error al insertar nuevos detalles: " + err.Error(),
@@ -1153,19 +1349,7 @@ func (h *OrderHandler) UpdateOrderClient(c *gin.Context) {
 	// Convertir a respuesta
 	detallesResponse := make([]DetallePedidoResponse, 0, len(detallesActualizados))
 	for _, detalle := range detallesActualizados {
-		nombreProducto := ""
-		if detalle.Producto != nil {
-			nombreProducto = detalle.Producto.Nombre
-		}
-
-		detallesResponse = append(detallesResponse, DetallePedidoResponse{
-			ID:             detalle.ID,
-			ProductoID:     detalle.ProductoID,
-			Nombre:         nombreProducto,
-			Cantidad:       detalle.Cantidad,
-			PrecioUnitario: detalle.PrecioUnitario,
-			PrecioTotal:    detalle.PrecioTotal,
-		})
+		detallesResponse = append(detallesResponse, newDetallePedidoResponse(detalle))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -49,6 +49,9 @@ func (h *ProductoHandler) CreateProducto(c *gin.Context) {
 	// Insertar en la base de datos
 	_, err = h.db.NewInsert().Model(&nuevoProducto).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -62,8 +65,14 @@ func (h *ProductoHandler) CreateProducto(c *gin.Context) {
 func (h *ProductoHandler) GetAllProductos(c *gin.Context) {
 	var productos []models.Producto
 
-	// Consulta para obtener todos los productos
-	err := h.db.NewSelect().Model(&productos).Order("nombre ASC").Scan(c)
+	// Consulta para obtener todos los productos; con ?archived=true solo los archivados
+	query := h.db.NewSelect().Model(&productos)
+	if c.Query("archived") == "true" {
+		query = query.Where("archivado_at IS NOT NULL")
+	} else {
+		query = query.Where("archivado_at IS NULL")
+	}
+	err := query.Order("nombre ASC").Scan(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron obtener los productos"})
 		return
@@ -81,6 +90,7 @@ func (h *ProductoHandler) GetAllProductos(c *gin.Context) {
 			"ultima_vez_ingresado": producto.UltimaVezIngresado.Format("02/01/2006"),
 			"created_at":           producto.CreatedAt.Format("02/01/2006"),
 			"updated_at":           producto.UpdatedAt.Format("02/01/2006"),
+			"archivado_at":         formatFechaArchivado(producto.ArchivadoAt),
 		}
 		productosConFechasFormateadas = append(productosConFechasFormateadas, productoFormateado)
 	}
@@ -108,18 +118,67 @@ func (h *ProductoHandler) DeleteProducto(c *gin.Context) {
 		return
 	}
 
-	// Eliminar el producto de la base de datos
-	_, err = h.db.NewDelete().Model(&models.Producto{}).Where("id = ?", productID).Exec(c)
+	if producto.ArchivadoAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El producto ya está archivado"})
+		return
+	}
+
+	// Archivar el producto en lugar de eliminarlo: los detalles de pedidos antiguos lo siguen referenciando
+	_, err = h.db.NewUpdate().
+		Model((*models.Producto)(nil)).
+		Set("archivado_at = ?", time.Now()).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", productID).
+		Exec(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo eliminar el producto"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo archivar el producto"})
 		return
 	}
 
 	// Devolver una respuesta exitosa
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Producto eliminado correctamente",
+		"message": "Producto archivado correctamente",
+	})
+
+}
+
+// UnarchiveProducto vuelve a publicar un producto archivado
+func (h *ProductoHandler) UnarchiveProducto(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	result, err := h.db.NewUpdate().
+		Model((*models.Producto)(nil)).
+		Set("archivado_at = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", productID).
+		Where("archivado_at IS NOT NULL").
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo desarchivar el producto"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Producto archivado no encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Producto desarchivado correctamente",
 	})
+}
 
+// formatFechaArchivado formatea la fecha de archivo o devuelve nil si el producto está activo
+func formatFechaArchivado(fecha *time.Time) interface{} {
+	if fecha == nil {
+		return nil
+	}
+	return fecha.Format("02/01/2006")
 }
 
 func (h *ProductoHandler) UpdateProducto(c *gin.Context) {
@@ -182,6 +241,9 @@ func (h *ProductoHandler) UpdateProducto(c *gin.Context) {
 	// Actualizar el producto en la base de datos
 	_, err = h.db.NewUpdate().Model(&producto).Where("id = ?", productIDInt).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -218,6 +280,7 @@ func (h *ProductoHandler) GetProductoById(c *gin.Context) {
 		"ultima_vez_ingresado": producto.UltimaVezIngresado.Format("02/01/2006"),
 		"created_at":           producto.CreatedAt.Format("02/01/2006"),
 		"updated_at":           producto.UpdatedAt.Format("02/01/2006"),
+		"archivado_at":         formatFechaArchivado(producto.ArchivadoAt),
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -229,10 +292,11 @@ func (h *ProductoHandler) GetProductoById(c *gin.Context) {
 func (h *ProductoHandler) GetProductosForClientes(c *gin.Context) {
 	var productos []models.Producto
 
-	// Consultar solo productos disponibles y ordenados por nombre
+	// Consultar solo productos disponibles, no archivados y ordenados por nombre
 	err := h.db.NewSelect().
 		Model(&productos).
 		Where("disponible = ?", true).
+		Where("archivado_at IS NULL").
 		Order("nombre ASC").
 		Scan(c)
 
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+type RoleHandler struct {
+	db *bun.DB
+}
+
+func NewRoleHandler(db *bun.DB) *RoleHandler {
+	return &RoleHandler{db: db}
+}
+
+var errUltimoAdmin = errors.New("no se puede quitar el rol al último administrador")
+
+// ensureNotLastAdmin evita dejar el sistema sin administradores al cambiar el rol de un usuario
+func ensureNotLastAdmin(ctx context.Context, db bun.IDB, user *models.Usuario, nuevoRol string) error {
+	if user.Rol != utils.RolAdmin || nuevoRol == utils.RolAdmin {
+		return nil
+	}
+	admins, err := db.NewSelect().
+		Model((*models.Usuario)(nil)).
+		Where("rol = ?", utils.RolAdmin).
+		Count(ctx)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return errUltimoAdmin
+	}
+	return nil
+}
+
+// GetRoles devuelve los roles disponibles con sus permisos
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"roles":               utils.Roles(),
+			"permisos":            utils.Permissions(),
+			"scopes_autoservicio": utils.SelfServiceScopes(),
+		},
+	})
+}
+
+// AssignRole asigna un rol a un usuario
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+
+	var input struct {
+		Rol string `json:"rol" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Rol requerido: " + err.Error(),
+		})
+		return
+	}
+
+	if !utils.ValidRole(input.Rol) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Rol inválido",
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err = h.db.NewSelect().Model(user).Where("id = ?", id).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	if err := ensureNotLastAdmin(c, h.db, user, input.Rol); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUltimoAdmin) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	_, err = h.db.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		Set("rol = ?", input.Rol).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al asignar el rol",
+		})
+		return
+	}
+
+	// AuthMiddleware carga el rol desde la base de datos en cada petición, por lo que el cambio aplica de inmediato
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Rol asignado correctamente",
+		"data": gin.H{
+			"id":  user.ID,
+			"rol": input.Rol,
+		},
+	})
+}
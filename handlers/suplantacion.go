@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// suplantacionTTL es la vigencia del token de suplantación; no se emite refresh token
+const suplantacionTTL = 15 * time.Minute
+
+// ImpersonateUser emite un token de acceso del usuario indicado que además identifica al administrador (claim "act").
+// Solo se pueden suplantar clientes y el token no reemplaza la sesión del administrador
+func (h *UserHandler) ImpersonateUser(c *gin.Context) {
+	actorID := c.GetInt("userID")
+
+	// Ni las API keys ni un token de suplantación pueden iniciar otra suplantación
+	if c.GetString("authMethod") == utils.AuthMethodAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "No se puede suplantar usuarios con una API key",
+		})
+		return
+	}
+	if _, ok := utils.GetActor(c); ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Ya estás suplantando a un usuario",
+		})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+
+	var input struct {
+		Motivo string `json:"motivo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Motivo) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Debes indicar el motivo de la suplantación",
+		})
+		return
+	}
+
+	if targetID == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No puedes suplantarte a ti mismo",
+		})
+		return
+	}
+
+	usuario := new(models.Usuario)
+	err = h.db.NewSelect().Model(usuario).Where("id = ?", targetID).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+	if usuario.Rol != utils.RolCliente {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Solo se puede suplantar a clientes",
+		})
+		return
+	}
+
+	now := time.Now()
+	suplantacion := models.Suplantacion{
+		ActorID:   actorID,
+		UsuarioID: usuario.ID,
+		Motivo:    strings.TrimSpace(input.Motivo),
+		IP:        c.ClientIP(),
+		ExpiraAt:  now.Add(suplantacionTTL),
+		CreatedAt: now,
+	}
+	if _, err := h.db.NewInsert().Model(&suplantacion).Exec(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al registrar la suplantación",
+		})
+		return
+	}
+
+	actor := utils.Actor{UserID: actorID, Email: c.GetString("email"), SessionID: suplantacion.ID}
+	token, err := h.keys.GenerateImpersonationJWT(usuario.ID, usuario.Email, usuario.Rol, actor, suplantacionTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al generar el token de suplantación",
+		})
+		return
+	}
+
+	slog.InfoContext(c, "Suplantación iniciada",
+		"suplantacion_id", suplantacion.ID,
+		"actor_id", actor.UserID,
+		"actor_email", actor.Email,
+		"usuario_id", usuario.ID,
+		"usuario_email", usuario.Email,
+		"motivo", suplantacion.Motivo)
+
+	// El token solo se entrega en la respuesta para no reemplazar las cookies de sesión del administrador
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"access_token":    token,
+			"token_type":      "Bearer",
+			"expires_in":      int(suplantacionTTL.Seconds()),
+			"suplantacion_id": suplantacion.ID,
+			"usuario": gin.H{
+				"id":       usuario.ID,
+				"email":    usuario.Email,
+				"nombre":   usuario.Nombre,
+				"apellido": usuario.Apellido,
+			},
+		},
+	})
+}
+
+// GetImpersonations lista el historial de suplantaciones, opcionalmente filtrado por usuario o actor
+func (h *UserHandler) GetImpersonations(c *gin.Context) {
+	var suplantaciones []models.Suplantacion
+	query := h.db.NewSelect().Model(&suplantaciones).OrderExpr("created_at DESC").Limit(100)
+	if usuarioID, err := strconv.Atoi(c.Query("usuario_id")); err == nil {
+		query = query.Where("usuario_id = ?", usuarioID)
+	}
+	if actorID, err := strconv.Atoi(c.Query("actor_id")); err == nil {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if err := query.Scan(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al obtener las suplantaciones",
+		})
+		return
+	}
+
+	respuesta := make([]gin.H, 0, len(suplantaciones))
+	for _, s := range suplantaciones {
+		respuesta = append(respuesta, gin.H{
+			"id":            s.ID,
+			"actor_id":      s.ActorID,
+			"usuario_id":    s.UsuarioID,
+			"motivo":        s.Motivo,
+			"ip":            s.IP,
+			"expira_at":     s.ExpiraAt,
+			"finalizada_at": s.FinalizadaAt,
+			"created_at":    s.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    respuesta,
+	})
+}
+
+// EndImpersonation finaliza una suplantación; su token deja de ser aceptado aunque no haya expirado
+func (h *UserHandler) EndImpersonation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de suplantación inválido",
+		})
+		return
+	}
+
+	result, err := h.db.NewUpdate().
+		Model((*models.Suplantacion)(nil)).
+		Set("finalizada_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("finalizada_at IS NULL").
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al finalizar la suplantación",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Suplantación no encontrada o ya finalizada",
+		})
+		return
+	}
+
+	slog.InfoContext(c, "Suplantación finalizada", "suplantacion_id", id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Suplantación finalizada",
+	})
+}
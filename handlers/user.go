@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"cotizador-productos-eml/models"
+	"cotizador-productos-eml/utils"
+	"errors"
+	"log/slog"
 	"net/http"
-
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/uptrace/bun"
@@ -12,11 +17,13 @@ import (
 )
 
 type UserHandler struct {
-	db *bun.DB
+	db     *bun.DB
+	keys   *utils.JWTKeys
+	mailer *utils.Mailer
 }
 
-func NewUserHandler(db *bun.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *bun.DB, keys *utils.JWTKeys, mailer *utils.Mailer) *UserHandler {
+	return &UserHandler{db: db, keys: keys, mailer: mailer}
 }
 
 func (h *UserHandler) Me(c *gin.Context) {
@@ -36,39 +43,45 @@ func (h *UserHandler) Me(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{
+		"id":       usuario.ID,
+		"email":    usuario.Email,
+		"nombre":   usuario.Nombre,
+		"apellido": usuario.Apellido,
+		"celular":  usuario.Celular,
+		"ciudad":   usuario.Ciudad,
+		"region":   usuario.RegionCodigo,
+		"comuna":   usuario.ComunaCodigo,
+	}
+	// Permite al frontend mostrar que la sesión es una suplantación
+	if actor, ok := utils.GetActor(c); ok {
+		data["suplantado_por"] = gin.H{
+			"id":    actor.UserID,
+			"email": actor.Email,
+		}
+	}
+
 	// Responder con los datos del usuario (sin incluir la contraseña)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"id":       usuario.ID,
-			"email":    usuario.Email,
-			"nombre":   usuario.Nombre,
-			"apellido": usuario.Apellido,
-			"celular":  usuario.Celular,
-			"ciudad":   usuario.Ciudad,
-		},
+		"data":    data,
 	})
 
 }
 
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	userRole, exists := c.Get("rol")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "Acceso denegado: Se requieren privilegios de administrador",
-		})
-		c.Abort()
-		return
-	}
 	var input struct {
 		Nombre   string `json:"nombre"`
 		Apellido string `json:"apellido"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
 		Ciudad   string `json:"ciudad"`
+		Region   string `json:"region"`
+		Comuna   string `json:"comuna"`
 		Celular  string `json:"celular"`
 		Rol      string `json:"rol"`
+		// Con invite=true no se indica contraseña: el usuario la elige desde el enlace de activación
+		Invite bool `json:"invite"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -78,6 +91,8 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 
 	}
+	input.Email = utils.NormalizeEmail(input.Email)
+
 	// Verificar si ya existe un usuario con el mismo email
 	existingUser := new(models.Usuario)
 	err := h.db.NewSelect().Model(existingUser).Where("email = ?", input.Email).Scan(c)
@@ -89,6 +104,54 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	// Validar el rol solicitado
+	if input.Rol == "" {
+		input.Rol = utils.RolCliente
+	}
+	if !utils.ValidRole(input.Rol) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Rol inválido",
+		})
+		return
+	}
+	if input.Rol != utils.RolCliente && !utils.HasPermission(c.GetString("rol"), utils.PermRolesManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "No tienes permisos para asignar roles",
+		})
+		return
+	}
+
+	if input.Invite {
+		if input.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "El email es requerido para invitar a un usuario",
+			})
+			return
+		}
+		invitado := models.Usuario{
+			Nombre:    input.Nombre,
+			Apellido:  input.Apellido,
+			Email:     input.Email,
+			Celular:   input.Celular,
+			Rol:       input.Rol,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if !applyUbicacionUsuario(c, &invitado, input.Comuna, input.Region, input.Ciudad) {
+			return
+		}
+		h.inviteUser(c, &invitado)
+		return
+	}
+
+	// Validar la contraseña contra la política de seguridad
+	if !checkPasswordPolicy(c, input.Password, utils.PasswordUser{Email: input.Email, Nombre: input.Nombre, Apellido: input.Apellido}) {
+		return
+	}
+
 	// Encriptar la contraseña
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -105,15 +168,20 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		Apellido:   input.Apellido,
 		Email:      input.Email,
 		Password:   string(hashedPassword),
-		Ciudad:     input.Ciudad,
 		Celular:    input.Celular,
 		Rol:        input.Rol,
 		Verificado: true, // Email ya verificado
 	}
+	if !applyUbicacionUsuario(c, &newUser, input.Comuna, input.Region, input.Ciudad) {
+		return
+	}
 
 	// Insertar usuario en la base de datos
 	_, err = h.db.NewInsert().Model(&newUser).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error al crear el usuario",
@@ -145,6 +213,8 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		Nombre   *string `json:"nombre"`
 		Apellido *string `json:"apellido"`
 		Ciudad   *string `json:"ciudad"`
+		Region   *string `json:"region"`
+		Comuna   *string `json:"comuna"`
 		Celular  *string `json:"celular"`
 	}
 
@@ -174,8 +244,10 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	if input.Apellido != nil {
 		user.Apellido = *input.Apellido
 	}
-	if input.Ciudad != nil {
-		user.Ciudad = *input.Ciudad
+	if input.Ciudad != nil || input.Comuna != nil || input.Region != nil {
+		if !applyUbicacionUsuario(c, user, derefString(input.Comuna), derefString(input.Region), derefString(input.Ciudad)) {
+			return
+		}
 	}
 	if input.Celular != nil {
 		user.Celular = *input.Celular
@@ -198,16 +270,6 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
-	// Verificar que sea admin
-	userRole, exists := c.Get("rol")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "Acceso denegado: Se requieren privilegios de administrador",
-		})
-		return
-	}
-
 	// Obtener el ID del usuario a modificar
 	userID := c.Param("id")
 	if userID == "" {
@@ -223,6 +285,8 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		Apellido *string `json:"apellido"`
 		Email    *string `json:"email"`
 		Ciudad   *string `json:"ciudad"`
+		Region   *string `json:"region"`
+		Comuna   *string `json:"comuna"`
 		Celular  *string `json:"celular"`
 		Rol      *string `json:"rol"`
 	}
@@ -235,6 +299,24 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Los cambios de rol se validan igual que en la asignación de roles
+	if input.Rol != nil {
+		if !utils.ValidRole(*input.Rol) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Rol inválido",
+			})
+			return
+		}
+		if !utils.HasPermission(c.GetString("rol"), utils.PermRolesManage) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "No tienes permisos para asignar roles",
+			})
+			return
+		}
+	}
+
 	// Buscar al usuario en la base de datos
 	user := new(models.Usuario)
 	err := h.db.NewSelect().Model(user).Where("id = ?", userID).Scan(c)
@@ -246,7 +328,24 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if input.Rol != nil {
+		if err := ensureNotLastAdmin(c, h.db, user, *input.Rol); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errUltimoAdmin) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
 	// Verificar email único si se está actualizando
+	if input.Email != nil {
+		*input.Email = utils.NormalizeEmail(*input.Email)
+	}
 	if input.Email != nil && *input.Email != user.Email {
 		existingUser := new(models.Usuario)
 		err := h.db.NewSelect().Model(existingUser).Where("email = ?", *input.Email).Scan(c)
@@ -269,8 +368,10 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if input.Email != nil {
 		user.Email = *input.Email
 	}
-	if input.Ciudad != nil {
-		user.Ciudad = *input.Ciudad
+	if input.Ciudad != nil || input.Comuna != nil || input.Region != nil {
+		if !applyUbicacionUsuario(c, user, derefString(input.Comuna), derefString(input.Region), derefString(input.Ciudad)) {
+			return
+		}
 	}
 	if input.Celular != nil {
 		user.Celular = *input.Celular
@@ -282,6 +383,9 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	// Guardar cambios en la base de datos
 	_, err = h.db.NewUpdate().Model(user).Where("id = ?", userID).Exec(c)
 	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error al actualizar el usuario",
@@ -295,29 +399,153 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	})
 }
 
+// userSortColumns son las columnas por las que se puede ordenar el listado de usuarios
+var userSortColumns = map[string]string{
+	"id":               "usuario.id",
+	"nombre":           "usuario.nombre",
+	"apellido":         "usuario.apellido",
+	"email":            "usuario.email",
+	"created_at":       "usuario.created_at",
+	"total_pedidos":    "total_pedidos",
+	"ultimo_pedido_at": "ultimo_pedido_at",
+}
+
+// likeEscaper escapa los comodines de LIKE en el texto de búsqueda
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetAllUsers lista los usuarios con búsqueda, filtros, orden y paginación.
+//
+// Parámetros: q (nombre, apellido o email), rol, verificado, ciudad (comuna o texto), region,
+// deleted=true, sort (id, nombre, apellido, email, created_at, total_pedidos, ultimo_pedido_at),
+// order (asc o desc), page y page_size
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	userRole, exists := c.Get("rol")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	offset := (page - 1) * pageSize
+
+	sortColumn, ok := userSortColumns[c.DefaultQuery("sort", "created_at")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Campo de orden inválido",
+		})
+		return
+	}
+	order := strings.ToUpper(c.DefaultQuery("order", "desc"))
+	if order != "ASC" && order != "DESC" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "El orden debe ser asc o desc",
+		})
+		return
+	}
+
+	rol := c.Query("rol")
+	if rol != "" && !utils.ValidRole(rol) {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Acceso denegado: Se requieren privilegios de administrador",
+			"error":   "Rol inválido",
 		})
-		c.Abort()
 		return
 	}
+
+	var verificado *bool
+	if v := c.Query("verificado"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "El filtro verificado debe ser true o false",
+			})
+			return
+		}
+		verificado = &parsed
+	}
+
+	// Aplica los mismos filtros a la consulta de datos y a la de conteo
+	filtrar := func(q *bun.SelectQuery) *bun.SelectQuery {
+		if c.Query("deleted") == "true" {
+			q = q.WhereDeleted()
+		}
+		if texto := strings.TrimSpace(c.Query("q")); texto != "" {
+			patron := "%" + likeEscaper.Replace(texto) + "%"
+			q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Where("usuario.nombre ILIKE ?", patron).
+					WhereOr("usuario.apellido ILIKE ?", patron).
+					WhereOr("usuario.email ILIKE ?", patron).
+					WhereOr("usuario.nombre || ' ' || usuario.apellido ILIKE ?", patron)
+			})
+		}
+		if rol != "" {
+			q = q.Where("usuario.rol = ?", rol)
+		}
+		if verificado != nil {
+			q = q.Where("usuario.verificado = ?", *verificado)
+		}
+		if ciudad := strings.TrimSpace(c.Query("ciudad")); ciudad != "" {
+			// Los usuarios anteriores al listado de comunas solo tienen la ciudad como texto
+			if comuna, ok := utils.FindComuna(ciudad); ok {
+				q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					return q.Where("usuario.comuna_codigo = ?", comuna.Codigo).
+						WhereOr("usuario.ciudad ILIKE ?", likeEscaper.Replace(comuna.Nombre))
+				})
+			} else {
+				q = q.Where("usuario.ciudad ILIKE ?", "%"+likeEscaper.Replace(ciudad)+"%")
+			}
+		}
+		if regionValue := c.Query("region"); regionValue != "" {
+			region, ok := utils.FindRegion(regionValue)
+			if !ok {
+				// Una región inexistente no devuelve resultados
+				return q.Where("FALSE")
+			}
+			q = q.Where("usuario.region_codigo = ?", region.Codigo)
+		}
+		return q
+	}
+
+	count, err := filtrar(h.db.NewSelect().Model((*models.Usuario)(nil))).Count(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al contar los usuarios",
+		})
+		return
+	}
+
 	var usuarios []struct {
-		ID         uint   `json:"id"`
-		Email      string `json:"email"`
-		Nombre     string `json:"nombre"`
-		Apellido   string `json:"apellido"`
-		Ciudad     string `json:"ciudad"`
-		Celular    string `json:"celular"`
-		Rol        string `json:"rol"`
-		Verificado bool   `json:"verificado"`
+		ID             uint       `json:"id"`
+		Email          string     `json:"email"`
+		Nombre         string     `json:"nombre"`
+		Apellido       string     `json:"apellido"`
+		Ciudad         string     `json:"ciudad"`
+		Region         string     `json:"region" bun:"region_codigo"`
+		Comuna         string     `json:"comuna" bun:"comuna_codigo"`
+		Celular        string     `json:"celular"`
+		Rol            string     `json:"rol"`
+		Verificado     bool       `json:"verificado"`
+		CreatedAt      time.Time  `json:"created_at"`
+		DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+		TotalPedidos   int        `json:"total_pedidos"`
+		UltimoPedidoAt *time.Time `json:"ultimo_pedido_at"`
 	}
-	err := h.db.NewSelect().
-		Model((*models.Usuario)(nil)).
-		Column("id", "email", "nombre", "apellido", "ciudad", "celular", "rol", "verificado").
+	err = filtrar(h.db.NewSelect().Model((*models.Usuario)(nil))).
+		Column("id", "email", "nombre", "apellido", "ciudad", "region_codigo", "comuna_codigo", "celular", "rol", "verificado", "created_at", "deleted_at").
+		ColumnExpr("(SELECT COUNT(*) FROM pedidos AS p WHERE p.usuario_id = usuario.id) AS total_pedidos").
+		ColumnExpr("(SELECT MAX(p.created_at) FROM pedidos AS p WHERE p.usuario_id = usuario.id) AS ultimo_pedido_at").
+		OrderExpr(sortColumn+" "+order+" NULLS LAST").
+		OrderExpr("usuario.id ASC").
+		Limit(pageSize).
+		Offset(offset).
 		Scan(c, &usuarios)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -326,22 +554,29 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 		})
 		return
 	}
+
+	// Calcular datos de paginación
+	totalPages := (count + pageSize - 1) / pageSize
+	hasNext := page < totalPages
+	hasPrev := page > 1
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    usuarios,
+		"data": gin.H{
+			"usuarios": usuarios,
+			"pagination": gin.H{
+				"total":       count,
+				"page":        page,
+				"page_size":   pageSize,
+				"total_pages": totalPages,
+				"has_next":    hasNext,
+				"has_prev":    hasPrev,
+			},
+		},
 	})
 }
 
 func (h *UserHandler) GetUserByID(c *gin.Context) {
-	userRole, exists := c.Get("rol")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "Acceso denegado: Se requieren privilegios de administrador",
-		})
-		c.Abort()
-		return
-	}
 	userID := c.Param("id")
 
 	if userID == "" {
@@ -361,18 +596,23 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 	var usuario struct {
-		ID         uint   `json:"id"`
-		Email      string `json:"email"`
-		Nombre     string `json:"nombre"`
-		Apellido   string `json:"apellido"`
-		Ciudad     string `json:"ciudad"`
-		Celular    string `json:"celular"`
-		Rol        string `json:"rol"`
-		Verificado bool   `json:"verificado"`
+		ID         uint       `json:"id"`
+		Email      string     `json:"email"`
+		Nombre     string     `json:"nombre"`
+		Apellido   string     `json:"apellido"`
+		Ciudad     string     `json:"ciudad"`
+		Region     string     `json:"region" bun:"region_codigo"`
+		Comuna     string     `json:"comuna" bun:"comuna_codigo"`
+		Celular    string     `json:"celular"`
+		Rol        string     `json:"rol"`
+		Verificado bool       `json:"verificado"`
+		DeletedAt  *time.Time `json:"deleted_at,omitempty"`
 	}
+	// Los administradores también pueden consultar usuarios eliminados (p. ej. desde un pedido antiguo)
 	err = h.db.NewSelect().
 		Model((*models.Usuario)(nil)).
-		Column("id", "email", "nombre", "apellido", "ciudad", "celular", "rol", "verificado").
+		WhereAllWithDeleted().
+		Column("id", "email", "nombre", "apellido", "ciudad", "region_codigo", "comuna_codigo", "celular", "rol", "verificado", "deleted_at").
 		Where("id = ?", id).
 		Scan(c, &usuario)
 	if err != nil {
@@ -389,15 +629,6 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
-	userRole, exists := c.Get("rol")
-	if !exists || userRole != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "Acceso denegado: Se requieren privilegios de administrador",
-		})
-		c.Abort()
-		return
-	}
 	userID := c.Param("id")
 
 	if userID == "" {
@@ -417,7 +648,54 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.NewDelete().Model((*models.Usuario)(nil)).Where("id = ?", id).Exec(c)
+	if int(id) == c.GetInt("userID") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No puedes eliminar tu propia cuenta",
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err = h.db.NewSelect().Model(user).Where("id = ?", id).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	if err := ensureNotLastAdmin(c, h.db, user, ""); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUltimoAdmin) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Los pedidos referencian al usuario, por lo que solo se marca como eliminado (deleted_at).
+	// Con ?anonymize=true además se borran sus datos personales, direcciones y credenciales
+	err = h.db.RunInTx(c, nil, func(ctx context.Context, tx bun.Tx) error {
+		if c.Query("anonymize") == "true" {
+			if err := anonymizeUsuario(ctx, tx, user.ID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewDelete().Model((*models.Usuario)(nil)).Where("id = ?", user.ID).Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errEmpresaSinAdmin) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "El usuario es el único administrador de una empresa con otros miembros",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -430,3 +708,352 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		"message": "Usuario eliminado correctamente",
 	})
 }
+
+// RestoreUser reactiva un usuario eliminado
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "ID de usuario inválido",
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err = h.db.NewSelect().
+		Model(user).
+		WhereDeleted().
+		Where("id = ?", id).
+		Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario eliminado no encontrado",
+		})
+		return
+	}
+
+	// Sin contraseña la cuenta no podría usarse: es una invitación nunca activada o una cuenta anonimizada
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "El usuario no tiene contraseña y no se puede restaurar; envíale una nueva invitación",
+		})
+		return
+	}
+
+	// El email pudo ser registrado por otra cuenta mientras el usuario estaba eliminado
+	existingUser := new(models.Usuario)
+	err = h.db.NewSelect().Model(existingUser).Where("email = ?", user.Email).Scan(c)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "El email del usuario ya está registrado en otra cuenta",
+		})
+		return
+	}
+
+	_, err = h.db.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		WhereAllWithDeleted().
+		Set("deleted_at = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Exec(c)
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al restaurar el usuario",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Usuario restaurado correctamente",
+	})
+}
+
+// ChangePassword permite al usuario autenticado cambiar su contraseña indicando la actual
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "No autorizado",
+		})
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err := h.db.NewSelect().Model(user).Where("id = ?", userID).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	// Verificar la contraseña actual
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "La contraseña actual es incorrecta",
+		})
+		return
+	}
+
+	if input.CurrentPassword == input.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "La nueva contraseña debe ser distinta de la actual",
+		})
+		return
+	}
+
+	if !checkPasswordPolicy(c, input.NewPassword, utils.PasswordUser{Email: user.Email, Nombre: user.Nombre, Apellido: user.Apellido}) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al encriptar la contraseña",
+		})
+		return
+	}
+
+	_, err = h.db.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		Set("password = ?", string(hash)).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", user.ID).
+		Exec(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar la contraseña",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Contraseña actualizada exitosamente",
+	})
+}
+
+// RequestEmailChange envía un enlace de confirmación a la nueva dirección; el email no cambia hasta confirmarlo
+func (h *UserHandler) RequestEmailChange(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "No autorizado",
+		})
+		return
+	}
+
+	var input struct {
+		NewEmail string `json:"new_email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	input.NewEmail = utils.NormalizeEmail(input.NewEmail)
+
+	user := new(models.Usuario)
+	err := h.db.NewSelect().Model(user).Where("id = ?", userID).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "La contraseña es incorrecta",
+		})
+		return
+	}
+
+	if input.NewEmail == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "El nuevo email debe ser distinto del actual",
+		})
+		return
+	}
+
+	existingUser := new(models.Usuario)
+	err = h.db.NewSelect().Model(existingUser).Where("email = ?", input.NewEmail).Scan(c)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "El email ya está registrado",
+		})
+		return
+	}
+
+	// El token lleva la nueva dirección en el claim "email" y la actual en "email_actual"
+	changeToken, err := h.keys.GenerateEmailChangeJWT(
+		user.ID,
+		user.Email,
+		input.NewEmail,
+		user.Rol,
+		24*time.Hour,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error generando token de confirmación",
+		})
+		return
+	}
+
+	if err := h.mailer.SendEmailChangeConfirmation(c, input.NewEmail, changeToken); err != nil {
+		slog.ErrorContext(c, "Error enviando email de cambio de email", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al enviar el email de confirmación",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Te enviamos un enlace de confirmación a la nueva dirección",
+	})
+}
+
+// ConfirmEmailChange aplica el cambio de email a partir del enlace enviado y notifica a la dirección anterior
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token de confirmación requerido",
+		})
+		return
+	}
+
+	claims, err := h.keys.ParseJWT(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido o expirado",
+		})
+		return
+	}
+
+	if tokenType, ok := claims["type"].(string); !ok || tokenType != "change_email" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Tipo de token inválido",
+		})
+		return
+	}
+
+	userID, ok := claims["sub"].(float64)
+	newEmail, emailOk := claims["email"].(string)
+	currentEmail, currentOk := claims["email_actual"].(string)
+	if !ok || !emailOk || !currentOk || newEmail == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido",
+		})
+		return
+	}
+
+	user := new(models.Usuario)
+	err = h.db.NewSelect().Model(user).Where("id = ?", int(userID)).Scan(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuario no encontrado",
+		})
+		return
+	}
+
+	if user.Email == newEmail {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "El cambio de email ya fue confirmado",
+		})
+		return
+	}
+
+	// Si el email cambió después de la solicitud (por ejemplo con otro enlace), este enlace ya no corresponde a la cuenta
+	if user.Email != currentEmail {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Token inválido",
+		})
+		return
+	}
+
+	// Volver a verificar que nadie haya tomado la dirección mientras tanto
+	existingUser := new(models.Usuario)
+	err = h.db.NewSelect().Model(existingUser).Where("email = ?", newEmail).Scan(c)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "El email ya está registrado",
+		})
+		return
+	}
+
+	oldEmail := user.Email
+	_, err = h.db.NewUpdate().
+		Model((*models.Usuario)(nil)).
+		Set("email = ?", newEmail).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", user.ID).
+		Exec(c)
+	if err != nil {
+		if respondConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al actualizar el email",
+		})
+		return
+	}
+
+	if err := h.mailer.SendEmailChangedNotification(c, oldEmail, newEmail); err != nil {
+		slog.ErrorContext(c, "Error notificando el cambio de email", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Email actualizado exitosamente. Inicia sesión nuevamente con tu nuevo email",
+	})
+}
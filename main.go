@@ -1,48 +1,84 @@
 package main
 
 import (
+	"cotizador-productos-eml/commands"
+	"cotizador-productos-eml/config"
 	"cotizador-productos-eml/db"
-	"cotizador-productos-eml/routes"
-	"log"
+	"cotizador-productos-eml/utils"
+	"fmt"
+	"log/slog"
 	"os"
-	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/uptrace/bun"
 )
 
+// command es un subcomando de la aplicación; todos reciben la conexión de db.ConnectDB y la configuración
+type command struct {
+	run         func(conn *bun.DB, cfg *config.Config, args []string) error
+	descripcion string
+}
+
+var comandos = map[string]command{
+	"serve":          {commands.Serve, "Inicia la API (comando por defecto)"},
+	"migrate":        {commands.Migrate, "Administra las migraciones: up, down o status"},
+	"seed":           {commands.Seed, "Carga productos, usuarios y pedidos de demostración"},
+	"create-admin":   {commands.CreateAdmin, "Crea un administrador o asigna el rol a un usuario existente (-email)"},
+	"reset-password": {commands.ResetPassword, "Asigna una contraseña nueva a un usuario (-email)"},
+}
+
 func main() {
 
-	// Cargar el archivo .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("Error al cargar el archivo .env ", err)
+	// Cargar el archivo .env; en producción las variables suelen venir del entorno
+	envErr := godotenv.Load()
+
+	// Sin argumentos se inicia el servidor
+	nombre := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		nombre, args = args[0], args[1:]
+	}
+
+	cmd, ok := comandos[nombre]
+	if !ok {
+		usage()
+		if nombre == "help" || nombre == "-h" || nombre == "--help" {
+			return
+		}
+		os.Exit(2)
+	}
+
+	// La configuración se lee una sola vez; un valor inválido detiene el arranque
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Configuración inválida", "error", err)
+		os.Exit(1)
+	}
+
+	utils.SetupLogger(cfg.LogLevel)
+	if envErr != nil {
+		slog.Info("No se cargó el archivo .env", "error", envErr)
+	}
+
+	conn, err := db.ConnectDB(cfg.DatabaseURL)
+	if err != nil {
+		slog.Error("Error al conectar a la base de datos", "error", err)
+		os.Exit(1)
+	}
+
+	// La conexión se cierra después de que el comando termina (en serve, tras drenar las peticiones)
+	err = cmd.run(conn, cfg, args)
+	conn.Close()
+	if err != nil {
+		slog.Error("Error al ejecutar el comando", "comando", nombre, "error", err)
+		os.Exit(1)
 	}
+}
 
-	db := db.ConnectDB()
-	defer db.Close()
-	// Configuración del router de Gin
-	r := gin.Default()
-
-	frontendUrl := os.Getenv("FRONTEND_URL")
-
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{frontendUrl},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With", "Access-Control-Allow-Origin", "Cookie", "Set-Cookie"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Set-Cookie", "Cookie"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// Registrar rutas
-	routes.RegisterProductoRoutes(r, db)
-	routes.AuthRoutes(r, db)
-	routes.UserRoutes(r, db)
-	routes.OrderRoutes(r, db)
-
-	// Iniciar el servidor
-	if err := r.Run(":8000"); err != nil {
-		log.Fatal("Error al iniciar el servidor:", err)
+func usage() {
+	fmt.Fprintln(os.Stderr, "Uso: go run main.go [comando] [opciones]")
+	fmt.Fprintln(os.Stderr, "\nComandos:")
+	for _, nombre := range []string{"serve", "migrate", "seed", "create-admin", "reset-password"} {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", nombre, comandos[nombre].descripcion)
 	}
 }
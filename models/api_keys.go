@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type APIKey struct {
+	bun.BaseModel `bun:"api_keys"`
+	ID            int        `bun:"id,pk,autoincrement"`
+	UsuarioID     int        `bun:"usuario_id"`
+	Usuario       *Usuario   `bun:"rel:belongs-to,join:usuario_id=id"`
+	Nombre        string     `bun:"nombre"`
+	Prefijo       string     `bun:"prefijo,unique"`
+	KeyHash       string     `bun:"key_hash"`
+	Scopes        []string   `bun:"scopes,array"`
+	ExpiraAt      *time.Time `bun:"expira_at"`
+	UltimoUsoAt   *time.Time `bun:"ultimo_uso_at"`
+	RevocadaAt    *time.Time `bun:"revocada_at"`
+	CreatedAt     time.Time  `bun:"created_at"`
+}
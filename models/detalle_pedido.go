@@ -13,6 +13,7 @@ type DetallePedido struct {
 	Pedido         *Pedido   `bun:"rel:belongs-to,join:pedido_id=id"`
 	ProductoID     int       `bun:"producto_id"`
 	Producto       *Producto `bun:"rel:belongs-to,join:producto_id=id"`
+	NombreProducto string    `bun:"nombre_producto"` // Nombre del producto al momento de crear o modificar la línea
 	Cantidad       int       `bun:"cantidad"`
 	PrecioUnitario int       `bun:"precio_unitario"`
 	PrecioTotal    int       `bun:"precio_total"`
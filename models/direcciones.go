@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type Direccion struct {
+	bun.BaseModel  `bun:"direcciones"`
+	ID             int       `bun:"id,pk,autoincrement"`
+	UsuarioID      int       `bun:"usuario_id"`
+	Usuario        *Usuario  `bun:"rel:belongs-to,join:usuario_id=id"`
+	Alias          string    `bun:"alias"`
+	Region         string    `bun:"region"`
+	Ciudad         string    `bun:"ciudad"`
+	Comuna         string    `bun:"comuna"`
+	RegionCodigo   string    `bun:"region_codigo"`
+	ComunaCodigo   string    `bun:"comuna_codigo"`
+	Direccion      string    `bun:"direccion"`
+	Rut            string    `bun:"rut"`
+	Telefono       string    `bun:"telefono"`
+	Predeterminada bool      `bun:"predeterminada,default:false"`
+	CreatedAt      time.Time `bun:"created_at"`
+	UpdatedAt      time.Time `bun:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Empresa es una cuenta de empresa con los datos de facturación; varios usuarios pueden pertenecer a ella
+type Empresa struct {
+	bun.BaseModel       `bun:"empresas"`
+	ID                  int       `bun:"id,pk,autoincrement"`
+	RazonSocial         string    `bun:"razon_social"`
+	Rut                 string    `bun:"rut,unique"`
+	Giro                string    `bun:"giro"`
+	DireccionTributaria string    `bun:"direccion_tributaria"`
+	Comuna              string    `bun:"comuna"`
+	Ciudad              string    `bun:"ciudad"`
+	EmailFacturacion    string    `bun:"email_facturacion"`
+	CreatedAt           time.Time `bun:"created_at"`
+	UpdatedAt           time.Time `bun:"updated_at"`
+}
+
+// EmpresaUsuario vincula un usuario con una empresa; los administradores pueden editarla y gestionar sus miembros.
+// Mientras AceptadaAt es nil la membresía es una invitación pendiente y no da acceso a la empresa
+type EmpresaUsuario struct {
+	bun.BaseModel `bun:"empresa_usuarios"`
+	EmpresaID     int        `bun:"empresa_id,pk"`
+	Empresa       *Empresa   `bun:"rel:belongs-to,join:empresa_id=id"`
+	UsuarioID     int        `bun:"usuario_id,pk"`
+	Usuario       *Usuario   `bun:"rel:belongs-to,join:usuario_id=id"`
+	Administrador bool       `bun:"administrador,default:false"`
+	AceptadaAt    *time.Time `bun:"aceptada_at"`
+	CreatedAt     time.Time  `bun:"created_at"`
+}
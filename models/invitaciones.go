@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Invitacion es el enlace de activación de un usuario creado por un administrador. Solo se guarda el hash del token
+type Invitacion struct {
+	bun.BaseModel `bun:"invitaciones"`
+	ID            int        `bun:"id,pk,autoincrement"`
+	UsuarioID     int        `bun:"usuario_id"`
+	Usuario       *Usuario   `bun:"rel:belongs-to,join:usuario_id=id"`
+	InvitadoPor   int        `bun:"invitado_por"`
+	TokenHash     string     `bun:"token_hash,unique"`
+	ExpiraAt      time.Time  `bun:"expira_at"`
+	EnviadaAt     time.Time  `bun:"enviada_at"`
+	Envios        int        `bun:"envios,default:1"`
+	AceptadaAt    *time.Time `bun:"aceptada_at"`
+	CanceladaAt   *time.Time `bun:"cancelada_at"`
+	CreatedAt     time.Time  `bun:"created_at"`
+}
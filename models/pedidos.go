@@ -15,12 +15,21 @@ type Pedido struct {
 	Estado           string     `bun:"estado"`
 	FechaEnvio       *time.Time `bun:"fecha_envio"`
 	CiudadDestino    string     `bun:"ciudad_destino"`
+	RegionDestino    string     `bun:"region_destino"` // Código CUT de la región
+	ComunaDestino    string     `bun:"comuna_destino"` // Código CUT de la comuna
 	DireccionDestino string     `bun:"direccion_destino"`
 	RutDestinatario  string     `bun:"rut_destinatario"`
+	TelefonoDestino  string     `bun:"telefono_destino"`
 	Company          string     `bun:"company"`
 	TipoEnvio        string     `bun:"tipo_envio"`
 	MetodoPago       string     `bun:"metodo_pago"`
 	TipoDocumento    string     `bun:"tipo_documento"`
-	CreatedAt        time.Time  `bun:"created_at"`
-	UpdatedAt        time.Time  `bun:"updated_at"`
+	// Datos de facturación copiados de la empresa al crear un pedido con factura
+	EmpresaID                  *int      `bun:"empresa_id"`
+	FacturaRazonSocial         string    `bun:"factura_razon_social"`
+	FacturaRut                 string    `bun:"factura_rut"`
+	FacturaGiro                string    `bun:"factura_giro"`
+	FacturaDireccionTributaria string    `bun:"factura_direccion_tributaria"`
+	CreatedAt                  time.Time `bun:"created_at"`
+	UpdatedAt                  time.Time `bun:"updated_at"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Suplantacion registra cada vez que un administrador obtiene un token para actuar como otro usuario.
+// El token solo es válido mientras la suplantación no expire ni se finalice
+type Suplantacion struct {
+	bun.BaseModel `bun:"suplantaciones"`
+	ID            int        `bun:"id,pk,autoincrement"`
+	ActorID       int        `bun:"actor_id"`
+	UsuarioID     int        `bun:"usuario_id"`
+	Motivo        string     `bun:"motivo"`
+	IP            string     `bun:"ip"`
+	ExpiraAt      time.Time  `bun:"expira_at"`
+	FinalizadaAt  *time.Time `bun:"finalizada_at"`
+	CreatedAt     time.Time  `bun:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type UsuarioMFA struct {
+	bun.BaseModel  `bun:"usuario_mfa"`
+	UsuarioID      int        `bun:"usuario_id,pk"`
+	Usuario        *Usuario   `bun:"rel:belongs-to,join:usuario_id=id"`
+	Secreto        string     `bun:"secreto"`
+	Habilitado     bool       `bun:"habilitado,default:false"`
+	UltimoPaso     int64      `bun:"ultimo_paso,default:0"`
+	Intentos       int        `bun:"intentos,default:0"`
+	BloqueadoHasta *time.Time `bun:"bloqueado_hasta"`
+	TokenJTI       string     `bun:"token_jti,nullzero"`
+	ConfirmadoAt   *time.Time `bun:"confirmado_at"`
+	CreatedAt      time.Time  `bun:"created_at"`
+	UpdatedAt      time.Time  `bun:"updated_at"`
+}
+
+type CodigoRecuperacion struct {
+	bun.BaseModel `bun:"codigos_recuperacion"`
+	ID            int        `bun:"id,pk,autoincrement"`
+	UsuarioID     int        `bun:"usuario_id"`
+	Usuario       *Usuario   `bun:"rel:belongs-to,join:usuario_id=id"`
+	CodigoHash    string     `bun:"codigo_hash"`
+	UsadoAt       *time.Time `bun:"usado_at"`
+	CreatedAt     time.Time  `bun:"created_at"`
+}
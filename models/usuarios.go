@@ -15,8 +15,11 @@ type Usuario struct {
 	Password      string    `bun:"password"`
 	Rol           string    `bun:"rol,default:'cliente'"`
 	Ciudad        string    `bun:"ciudad"`
+	RegionCodigo  string    `bun:"region_codigo"`
+	ComunaCodigo  string    `bun:"comuna_codigo"`
 	Celular       string    `bun:"celular"`
 	Verificado    bool      `bun:"verificado,default:false"`
 	CreatedAt     time.Time `bun:"created_at"`
 	UpdatedAt     time.Time `bun:"updated_at"`
+	DeletedAt     time.Time `bun:"deleted_at,soft_delete,nullzero"`
 }
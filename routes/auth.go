@@ -1,14 +1,16 @@
 package routes
 
 import (
+	"cotizador-productos-eml/config"
 	"cotizador-productos-eml/handlers"
+	"cotizador-productos-eml/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/uptrace/bun"
 )
 
-func AuthRoutes(router *gin.Engine, db *bun.DB) {
-	handler := handlers.NewAuthHandler(db)
+func AuthRoutes(router *gin.Engine, db *bun.DB, cfg *config.Config, keys *utils.JWTKeys, mailer *utils.Mailer) {
+	handler := handlers.NewAuthHandler(db, cfg, keys, mailer)
 	authRoutes := router.Group("/auth")
 	{
 		authRoutes.POST("/register", handler.Register)
@@ -20,5 +22,30 @@ func AuthRoutes(router *gin.Engine, db *bun.DB) {
 		authRoutes.POST("/forgot-password", handler.ForgotPassword)
 		authRoutes.POST("/reset-password", handler.ResetPassword)
 		authRoutes.GET("/verify", handler.VerifyAuth)
+		authRoutes.POST("/mfa/verify", handler.VerifyMFA)
+	}
+
+	// Inscripción de 2FA: acepta la sesión normal o el token "mfa_enroll" emitido por Login
+	mfaEnrollRoutes := router.Group("/auth/mfa")
+	mfaEnrollRoutes.Use(utils.MFAEnrollMiddleware(db, keys))
+	mfaEnrollRoutes.Use(utils.DenyImpersonation())
+	{
+		mfaEnrollRoutes.POST("/enroll", handler.EnrollMFA)
+		mfaEnrollRoutes.POST("/confirm", handler.ConfirmMFA)
+	}
+
+	sessionRoutes := router.Group("/auth")
+	sessionRoutes.Use(utils.AuthMiddleware(db, keys))
+	{
+		sessionRoutes.GET("/csrf-token", handler.CSRFToken)
+	}
+
+	// Sin scopes: las API keys no pueden gestionar el 2FA
+	mfaRoutes := router.Group("/auth/mfa")
+	mfaRoutes.Use(utils.AuthMiddleware(db, keys))
+	mfaRoutes.Use(utils.DenyImpersonation())
+	{
+		mfaRoutes.POST("/disable", handler.DisableMFA)
+		mfaRoutes.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
 	}
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"cotizador-productos-eml/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GeoRoutes(router *gin.Engine) {
+	geoRoutes := router.Group("/geo")
+	{
+		geoRoutes.GET("/regiones", handlers.GetRegiones)
+		geoRoutes.GET("/regiones/:id/comunas", handlers.GetComunas)
+	}
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"cotizador-productos-eml/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+// HealthRoutes registra las sondas de liveness y readiness, sin autenticación
+func HealthRoutes(router *gin.Engine, db *bun.DB) {
+	handler := handlers.NewHealthHandler(db)
+	router.GET("/healthz", handler.Liveness)
+	router.GET("/readyz", handler.Readiness)
+}
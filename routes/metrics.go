@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"cotizador-productos-eml/config"
+	"cotizador-productos-eml/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsRoutes expone las métricas de Prometheus solo si METRICS_ENABLED=true
+func MetricsRoutes(router *gin.Engine, cfg *config.Config) {
+	if !cfg.Metrics.Enabled {
+		return
+	}
+	handler := promhttp.HandlerFor(utils.MetricsRegistry, promhttp.HandlerOpts{})
+	router.GET("/metrics", utils.MetricsTokenMiddleware(cfg.Metrics.Token), gin.WrapH(handler))
+}
@@ -8,24 +8,23 @@ import (
 	"github.com/uptrace/bun"
 )
 
-func OrderRoutes(router *gin.Engine, db *bun.DB) {
+func OrderRoutes(router *gin.Engine, db *bun.DB, keys *utils.JWTKeys) {
 	handler := handlers.NewOrderHandler(db)
 
+	// Cada ruta declara el scope que necesita una API key
 	orderRoutes := router.Group("/orders")
-	orderRoutes.Use(utils.AuthMiddleware())
 	{
-		orderRoutes.POST("/create-order", handler.CreateOrder)
-		orderRoutes.GET("/get-user-orders", handler.GetUserOrders)
-		orderRoutes.GET("/get-order-detail", handler.GetOrderDetail)
-		orderRoutes.PATCH("/update-order-client", handler.UpdateOrderClient)
+		orderRoutes.POST("/create-order", utils.AuthMiddleware(db, keys, utils.ScopeOrdersCreate), handler.CreateOrder)
+		orderRoutes.GET("/get-user-orders", utils.AuthMiddleware(db, keys, utils.ScopeOrdersRead), handler.GetUserOrders)
+		orderRoutes.GET("/get-order-detail", utils.AuthMiddleware(db, keys, utils.ScopeOrdersRead), handler.GetOrderDetail)
+		orderRoutes.PATCH("/update-order-client", utils.AuthMiddleware(db, keys, utils.ScopeOrdersUpdateOwn), handler.UpdateOrderClient)
 	}
 
-	// Grupo de rutas protegidas con middleware de autenticación y rol de admin
+	// Grupo de rutas protegidas para el personal que gestiona pedidos
 	adminOrderRoutes := router.Group("/orders")
-	adminOrderRoutes.Use(utils.AuthMiddleware())
-	adminOrderRoutes.Use(utils.RoleMiddleware("admin"))
 	{
-		adminOrderRoutes.GET("/get-orders", handler.GetOrders)
-		adminOrderRoutes.PATCH("/update-order-admin", handler.UpdateOrderAdmin)
+		adminOrderRoutes.GET("/get-orders", utils.AuthMiddleware(db, keys, utils.PermOrdersReadAll), utils.RequirePermission(utils.PermOrdersReadAll), handler.GetOrders)
+		// Quien solo tiene orders:update_status puede cambiar el estado y la fecha de envío (ver UpdateOrderAdmin)
+		adminOrderRoutes.PATCH("/update-order-admin", utils.AuthMiddleware(db, keys, utils.PermOrdersUpdateState), utils.RequirePermission(utils.PermOrdersUpdateState), handler.UpdateOrderAdmin)
 	}
 }
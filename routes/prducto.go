@@ -8,24 +8,32 @@ import (
 	"github.com/uptrace/bun"
 )
 
-func RegisterProductoRoutes(router *gin.Engine, db *bun.DB) {
+func RegisterProductoRoutes(router *gin.Engine, db *bun.DB, keys *utils.JWTKeys) {
 	handler := handlers.NewProductoHandler(db)
 
-	// Grupo de rutas protegidas con middleware de autenticación y rol de admin
+	// Grupo de rutas protegidas que permiten ver el catálogo completo
 	productoRoutes := router.Group("/productos")
-	productoRoutes.Use(utils.AuthMiddleware())
-	productoRoutes.Use(utils.RoleMiddleware("admin"))
+	productoRoutes.Use(utils.AuthMiddleware(db, keys, utils.PermProductsRead))
+	productoRoutes.Use(utils.RequirePermission(utils.PermProductsRead))
 	{
-		productoRoutes.POST("", handler.CreateProducto)
 		productoRoutes.GET("", handler.GetAllProductos)
-		productoRoutes.DELETE("/:id", handler.DeleteProducto)
-		productoRoutes.PUT("/:id", handler.UpdateProducto)
 		productoRoutes.GET("/:id", handler.GetProductoById)
 	}
 
+	// Grupo de rutas protegidas que modifican el catálogo
+	productoWriteRoutes := router.Group("/productos")
+	productoWriteRoutes.Use(utils.AuthMiddleware(db, keys, utils.PermProductsWrite))
+	productoWriteRoutes.Use(utils.RequirePermission(utils.PermProductsWrite))
+	{
+		productoWriteRoutes.POST("", handler.CreateProducto)
+		productoWriteRoutes.DELETE("/:id", handler.DeleteProducto)
+		productoWriteRoutes.PUT("/:id", handler.UpdateProducto)
+		productoWriteRoutes.PATCH("/:id/unarchive", handler.UnarchiveProducto)
+	}
+
 	// Grupo de rutas que solo requieren autenticación (sin permisos de admin)
 	clientProductoRoutes := router.Group("/productos")
-	clientProductoRoutes.Use(utils.AuthMiddleware())
+	clientProductoRoutes.Use(utils.AuthMiddleware(db, keys, utils.ScopeProductsRead))
 	{
 		clientProductoRoutes.GET("/get-products-clients", handler.GetProductosForClientes)
 	}
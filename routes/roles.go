@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"cotizador-productos-eml/handlers"
+	"cotizador-productos-eml/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uptrace/bun"
+)
+
+func RoleRoutes(router *gin.Engine, db *bun.DB, keys *utils.JWTKeys) {
+	handler := handlers.NewRoleHandler(db)
+
+	roleRoutes := router.Group("/roles")
+	roleRoutes.Use(utils.AuthMiddleware(db, keys, utils.PermRolesManage))
+	roleRoutes.Use(utils.RequirePermission(utils.PermRolesManage))
+	{
+		roleRoutes.GET("", handler.GetRoles)
+		roleRoutes.PUT("/users/:id", handler.AssignRole)
+	}
+}
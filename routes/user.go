@@ -8,22 +8,87 @@ import (
 	"github.com/uptrace/bun"
 )
 
-func UserRoutes(router *gin.Engine, db *bun.DB) {
-	handler := handlers.NewUserHandler(db)
+func UserRoutes(router *gin.Engine, db *bun.DB, keys *utils.JWTKeys, mailer *utils.Mailer) {
+	handler := handlers.NewUserHandler(db, keys, mailer)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	direccionHandler := handlers.NewDireccionHandler(db)
+	empresaHandler := handlers.NewEmpresaHandler(db, mailer)
+	// Las rutas sin scopes no aceptan API keys: credenciales, API keys, exportación y eliminación de la cuenta
 	userRoutes := router.Group("/user")
-	userRoutes.Use(utils.AuthMiddleware())
+	userRoutes.Use(utils.AuthMiddleware(db, keys))
 	{
-		userRoutes.GET("/me", handler.Me)
 		userRoutes.PATCH("/update-profile", handler.UpdateProfile)
+		// Las acciones sobre credenciales no se permiten con un token de suplantación
+		userRoutes.POST("/change-password", utils.DenyImpersonation(), handler.ChangePassword)
+		userRoutes.POST("/change-email", utils.DenyImpersonation(), handler.RequestEmailChange)
+		userRoutes.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+		userRoutes.POST("/api-keys", utils.DenyImpersonation(), apiKeyHandler.CreateAPIKey)
+		userRoutes.DELETE("/api-keys/:id", utils.DenyImpersonation(), apiKeyHandler.RevokeAPIKey)
+		userRoutes.GET("/export", utils.DenyImpersonation(), handler.ExportUserData)
+		userRoutes.DELETE("/me", utils.DenyImpersonation(), handler.RequestAccountDeletion)
+	}
+
+	// Rutas de autoservicio que también aceptan API keys con el scope indicado
+	selfServiceRoutes := router.Group("/user")
+	{
+		selfServiceRoutes.GET("/me", utils.AuthMiddleware(db, keys, utils.ScopeProfileRead), handler.Me)
+
+		addressReadAuth := utils.AuthMiddleware(db, keys, utils.ScopeAddressesRead)
+		addressWriteAuth := utils.AuthMiddleware(db, keys, utils.ScopeAddressesWrite)
+		selfServiceRoutes.GET("/addresses", addressReadAuth, direccionHandler.GetDirecciones)
+		selfServiceRoutes.POST("/addresses", addressWriteAuth, direccionHandler.CreateDireccion)
+		selfServiceRoutes.PUT("/addresses/:id", addressWriteAuth, direccionHandler.UpdateDireccion)
+		selfServiceRoutes.DELETE("/addresses/:id", addressWriteAuth, direccionHandler.DeleteDireccion)
+		selfServiceRoutes.PATCH("/addresses/:id/default", addressWriteAuth, direccionHandler.SetDefaultDireccion)
+
+		companyReadAuth := utils.AuthMiddleware(db, keys, utils.ScopeCompaniesRead)
+		companyWriteAuth := utils.AuthMiddleware(db, keys, utils.ScopeCompaniesWrite)
+		selfServiceRoutes.GET("/companies", companyReadAuth, empresaHandler.GetEmpresas)
+		selfServiceRoutes.POST("/companies", companyWriteAuth, empresaHandler.CreateEmpresa)
+		selfServiceRoutes.PUT("/companies/:id", companyWriteAuth, empresaHandler.UpdateEmpresa)
+		selfServiceRoutes.GET("/company-invitations", companyReadAuth, empresaHandler.GetEmpresaInvitaciones)
+		selfServiceRoutes.POST("/companies/:id/accept", companyWriteAuth, empresaHandler.AcceptEmpresaInvitacion)
+		selfServiceRoutes.GET("/companies/:id/members", companyReadAuth, empresaHandler.GetEmpresaMiembros)
+		selfServiceRoutes.POST("/companies/:id/members", companyWriteAuth, empresaHandler.AddEmpresaMiembro)
+		selfServiceRoutes.DELETE("/companies/:id/members/:usuario_id", companyWriteAuth, empresaHandler.RemoveEmpresaMiembro)
+	}
+
+	// El enlace de confirmación llega por email, por lo que no requiere sesión
+	publicUserRoutes := router.Group("/user")
+	{
+		publicUserRoutes.GET("/confirm-email-change", handler.ConfirmEmailChange)
+		publicUserRoutes.POST("/confirm-delete-account", handler.ConfirmAccountDeletion)
+		publicUserRoutes.GET("/invitation", handler.GetInvitationByToken)
+		publicUserRoutes.POST("/accept-invitation", handler.AcceptInvitation)
+	}
+	readUserRoutes := router.Group("/user")
+	readUserRoutes.Use(utils.AuthMiddleware(db, keys, utils.PermUsersRead))
+	readUserRoutes.Use(utils.RequirePermission(utils.PermUsersRead))
+	{
+		readUserRoutes.GET("/get-users", handler.GetAllUsers)
+		readUserRoutes.GET("/get-user/:id", handler.GetUserByID)
 	}
 	adminUserRoutes := router.Group("/user")
-	adminUserRoutes.Use(utils.AuthMiddleware())
-	adminUserRoutes.Use(utils.RoleMiddleware("admin"))
+	adminUserRoutes.Use(utils.AuthMiddleware(db, keys, utils.PermUsersManage))
+	adminUserRoutes.Use(utils.RequirePermission(utils.PermUsersManage))
 	{
-		adminUserRoutes.GET("/get-users", handler.GetAllUsers)
 		adminUserRoutes.PATCH("/update-user/:id", handler.UpdateUser)
 		adminUserRoutes.DELETE("/delete-user/:id", handler.DeleteUser)
+		adminUserRoutes.PATCH("/restore-user/:id", handler.RestoreUser)
 		adminUserRoutes.POST("/create-user", handler.CreateUser)
-		adminUserRoutes.GET("/get-user/:id", handler.GetUserByID)
+		adminUserRoutes.GET("/invitations", handler.GetInvitations)
+		adminUserRoutes.POST("/invitations/:id/resend", handler.ResendInvitation)
+		adminUserRoutes.DELETE("/invitations/:id", handler.CancelInvitation)
+		adminUserRoutes.GET("/get-user/:id/api-keys", apiKeyHandler.ListUserAPIKeys)
+		adminUserRoutes.POST("/companies/reassign", empresaHandler.ReassignEmpresa)
+	}
+	// La suplantación no acepta API keys
+	impersonationRoutes := router.Group("/user")
+	impersonationRoutes.Use(utils.AuthMiddleware(db, keys))
+	impersonationRoutes.Use(utils.RequirePermission(utils.PermUsersImpersonate))
+	{
+		impersonationRoutes.POST("/impersonate/:id", handler.ImpersonateUser)
+		impersonationRoutes.GET("/impersonations", handler.GetImpersonations)
+		impersonationRoutes.DELETE("/impersonations/:id", handler.EndImpersonation)
 	}
 }
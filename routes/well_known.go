@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"cotizador-productos-eml/handlers"
+	"cotizador-productos-eml/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WellKnownRoutes(router *gin.Engine, keys *utils.JWTKeys) {
+	handler := handlers.NewJWKSHandler(keys)
+	wellKnownRoutes := router.Group("/.well-known")
+	{
+		wellKnownRoutes.GET("/jwks.json", handler.JWKS)
+	}
+}
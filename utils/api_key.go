@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const apiKeyPrefix = "eml"
+
+// GenerateAPIKey genera una API key con formato eml_<prefijo>_<secreto> y devuelve la key, su prefijo y su hash
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	prefixBytes := make([]byte, 4)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("error generando API key: %w", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("error generando API key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// ParseAPIKeyPrefix extrae el prefijo público de una API key
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || len(parts[1]) != 8 || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// HashAPIKey calcula el hash con el que se guarda la API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, "eml_"+prefix+"_") {
+		t.Errorf("la key %q no tiene el formato eml_<prefijo>_<secreto>", key)
+	}
+	if got, ok := ParseAPIKeyPrefix(key); !ok || got != prefix {
+		t.Errorf("ParseAPIKeyPrefix(key generada) = %q, %v, se esperaba %q, true", got, ok, prefix)
+	}
+	if hash != HashAPIKey(key) {
+		t.Error("el hash devuelto no coincide con HashAPIKey(key)")
+	}
+
+	other, otherPrefix, _, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if other == key || otherPrefix == prefix {
+		t.Error("GenerateAPIKey devolvió dos veces la misma key o el mismo prefijo")
+	}
+}
+
+func TestParseAPIKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"válida", "eml_0a1b2c3d_c2VjcmV0bw", "0a1b2c3d", true},
+		{"secreto con guion bajo", "eml_0a1b2c3d_abc_def", "0a1b2c3d", true},
+		{"otro prefijo de producto", "sk_0a1b2c3d_c2VjcmV0bw", "", false},
+		{"mayúsculas en el producto", "EML_0a1b2c3d_c2VjcmV0bw", "", false},
+		{"prefijo corto", "eml_0a1b2c_c2VjcmV0bw", "", false},
+		{"prefijo largo", "eml_0a1b2c3d4e_c2VjcmV0bw", "", false},
+		{"sin secreto", "eml_0a1b2c3d_", "", false},
+		{"sin separadores", "eml0a1b2c3dc2VjcmV0bw", "", false},
+		{"un JWT", "eyJhbGciOiJIUzI1NiJ9.e30.sig", "", false},
+		{"vacía", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, ok := ParseAPIKeyPrefix(tt.key)
+			if prefix != tt.prefix || ok != tt.ok {
+				t.Errorf("ParseAPIKeyPrefix(%q) = %q, %v, se esperaba %q, %v", tt.key, prefix, ok, tt.prefix, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"eml_0a1b2c3d_secreto", "77ebffe8369234bef5a32c515f5f2a3fed871fe26ca1a4a04dae4fef550bebb4"},
+	}
+	for _, tt := range tests {
+		if got := HashAPIKey(tt.key); got != tt.want {
+			t.Errorf("HashAPIKey(%q) = %q, se esperaba %q", tt.key, got, tt.want)
+		}
+	}
+	if HashAPIKey("eml_0a1b2c3d_secretO") == HashAPIKey("eml_0a1b2c3d_secreto") {
+		t.Error("HashAPIKey devolvió el mismo hash para keys distintas")
+	}
+}
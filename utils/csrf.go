@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CSRFCookieName es la cookie legible por el frontend que contiene el token CSRF
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName es la cabecera en la que el frontend debe reenviar el token CSRF
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// GenerateCSRFToken genera un token CSRF aleatorio
+func GenerateCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generando token CSRF: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// isSafeMethod indica si el método HTTP no modifica estado
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// passesCSRF indica si la petición supera la validación CSRF. Solo las mutaciones autenticadas con cookie
+// deben reenviar el token; Bearer y API key quedan exentos porque un sitio externo no puede enviar esas cabeceras
+func passesCSRF(c *gin.Context, authMethod string) bool {
+	return authMethod != AuthMethodCookie || isSafeMethod(c.Request.Method) || validCSRF(c)
+}
+
+// validCSRF compara el token de la cabecera con el de la cookie (double-submit)
+func validCSRF(c *gin.Context) bool {
+	cookieToken, err := c.Cookie(CSRFCookieName)
+	if err != nil || cookieToken == "" {
+		return false
+	}
+	headerToken := c.GetHeader(CSRFHeaderName)
+	if headerToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) == 1
+}
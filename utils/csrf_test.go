@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func csrfTestContext(method, cookieToken, headerToken string) *gin.Context {
+	req := httptest.NewRequest(method, "/user/update-profile", nil)
+	if cookieToken != "" {
+		req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: cookieToken})
+	}
+	if headerToken != "" {
+		req.Header.Set(CSRFHeaderName, headerToken)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	return c
+}
+
+func TestValidCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+		want   bool
+	}{
+		{"coinciden", "token-csrf", "token-csrf", true},
+		{"distintos", "token-csrf", "token-otro", false},
+		{"mismo prefijo", "token-csrf", "token-csr", false},
+		{"mayúsculas", "token-csrf", "TOKEN-CSRF", false},
+		{"sin cabecera", "token-csrf", "", false},
+		{"sin cookie", "", "token-csrf", false},
+		{"sin ninguno", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validCSRF(csrfTestContext(http.MethodPost, tt.cookie, tt.header)); got != tt.want {
+				t.Errorf("validCSRF(cookie %q, cabecera %q) = %v, se esperaba %v", tt.cookie, tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassesCSRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		authMethod string
+		method     string
+		header     string
+		want       bool
+	}{
+		{"cookie GET sin token", AuthMethodCookie, http.MethodGet, "", true},
+		{"cookie HEAD sin token", AuthMethodCookie, http.MethodHead, "", true},
+		{"cookie OPTIONS sin token", AuthMethodCookie, http.MethodOptions, "", true},
+		{"cookie POST sin token", AuthMethodCookie, http.MethodPost, "", false},
+		{"cookie PUT con otro token", AuthMethodCookie, http.MethodPut, "token-otro", false},
+		{"cookie PATCH sin token", AuthMethodCookie, http.MethodPatch, "", false},
+		{"cookie DELETE con el token", AuthMethodCookie, http.MethodDelete, "token-csrf", true},
+		{"bearer POST sin token", AuthMethodBearer, http.MethodPost, "", true},
+		{"API key DELETE sin token", AuthMethodAPIKey, http.MethodDelete, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := csrfTestContext(tt.method, "token-csrf", tt.header)
+			if got := passesCSRF(c, tt.authMethod); got != tt.want {
+				t.Errorf("passesCSRF(%s %s) = %v, se esperaba %v", tt.authMethod, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCSRFToken(t *testing.T) {
+	a, err := GenerateCSRFToken()
+	if err != nil {
+		t.Fatalf("GenerateCSRFToken: %v", err)
+	}
+	b, err := GenerateCSRFToken()
+	if err != nil {
+		t.Fatalf("GenerateCSRFToken: %v", err)
+	}
+	// 32 bytes en base64url sin relleno
+	if len(a) != 43 {
+		t.Errorf("largo del token = %d, se esperaba 43", len(a))
+	}
+	if a == b {
+		t.Error("GenerateCSRFToken devolvió dos veces el mismo token")
+	}
+}
@@ -2,11 +2,20 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"cotizador-productos-eml/config"
 	"encoding/json"
 	"fmt"
+	"html"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type EmailRequest struct {
@@ -16,17 +25,55 @@ type EmailRequest struct {
 	HTMLContent string              `json:"htmlContent"`
 }
 
-// sendEmail es una función genérica para enviar correos con Brevo
-func sendEmail(to, subject, htmlContent string) error {
-	apiKey := os.Getenv("BREVO_API_KEY")
+// Mailer envía los correos transaccionales con la cuenta de Brevo, el remitente y la URL del frontend
+// para los enlaces de la configuración. Se crea una vez al iniciar el servidor y se pasa a los handlers
+type Mailer struct {
+	cfg config.EmailConfig
+}
+
+func NewMailer(cfg config.EmailConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// brevoTimeout limita cada llamada a Brevo, ya que los envíos no se cancelan con la petición
+const brevoTimeout = 10 * time.Second
+
+// brevoClient propaga el contexto de la traza en las llamadas a Brevo
+var brevoClient = &http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+	Timeout:   brevoTimeout,
+}
+
+// sendEmail es una función genérica para enviar correos con Brevo. Cada envío se cuenta en la métrica
+// emails_total y queda en un span de la traza de la petición.
+// El envío no se cancela si el cliente se desconecta: los cambios en la base de datos ya se confirmaron
+func (m *Mailer) sendEmail(ctx context.Context, to, subject, htmlContent string) error {
+	ctx, span := tracer().Start(context.WithoutCancel(ctx), "brevo.send_email",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("email.subject", subject)),
+	)
+	defer span.End()
+
+	err := m.sendBrevoEmail(ctx, to, subject, htmlContent)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	recordEmail(err)
+	return err
+}
+
+// sendBrevoEmail envía el correo con la API transaccional de Brevo
+func (m *Mailer) sendBrevoEmail(ctx context.Context, to, subject, htmlContent string) error {
+	apiKey := m.cfg.BrevoAPIKey
 	if apiKey == "" {
 		return fmt.Errorf("BREVO_API_KEY no está configurada")
 	}
 
 	email := EmailRequest{
 		Sender: map[string]string{
-			"name":  "Cotizador Productos EML",
-			"email": "pipe12.fm@gmail.com", // Usa un correo verificado en Brevo
+			"name":  m.cfg.SenderName,
+			"email": m.cfg.SenderEmail, // Debe ser un correo verificado en Brevo
 		},
 		To: []map[string]string{
 			{"email": to, "name": "Usuario"},
@@ -40,15 +87,14 @@ func sendEmail(to, subject, htmlContent string) error {
 		return fmt.Errorf("error al serializar el correo: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.brevo.com/v3/smtp/email", bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.brevo.com/v3/smtp/email", bytes.NewBuffer(data))
 	if err != nil {
 		return fmt.Errorf("error creando la solicitud: %w", err)
 	}
 	req.Header.Set("api-key", apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := brevoClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("error enviando email: %w", err)
 	}
@@ -58,13 +104,13 @@ func sendEmail(to, subject, htmlContent string) error {
 		return fmt.Errorf("error en la respuesta de Brevo: %s", resp.Status)
 	}
 
-	fmt.Println("Email enviado con éxito:", resp.Status)
+	slog.InfoContext(ctx, "Email enviado", "asunto", subject, "status", resp.Status)
 	return nil
 }
 
 // SendVerificationEmail envía un email de verificación de cuenta
-func SendVerificationEmail(to, token string) error {
-	frontendURL := os.Getenv("FRONTEND_URL")
+func (m *Mailer) SendVerificationEmail(ctx context.Context, to, token string) error {
+	frontendURL := m.cfg.FrontendURL
 	if to == "" || token == "" {
 		return fmt.Errorf("parámetros inválidos: email o token vacío")
 	}
@@ -84,12 +130,12 @@ func SendVerificationEmail(to, token string) error {
 	</html>
 	`, verifyURL)
 
-	return sendEmail(to, "Verifica tu cuenta", htmlContent)
+	return m.sendEmail(ctx, to, "Verifica tu cuenta", htmlContent)
 }
 
 // SendPasswordResetEmail envía un email para restablecer la contraseña
-func SendPasswordResetEmail(to, token string) error {
-	frontendURL := os.Getenv("FRONTEND_URL")
+func (m *Mailer) SendPasswordResetEmail(ctx context.Context, to, token string) error {
+	frontendURL := m.cfg.FrontendURL
 	if to == "" || token == "" {
 		return fmt.Errorf("parámetros inválidos: email o token vacío")
 	}
@@ -109,5 +155,131 @@ func SendPasswordResetEmail(to, token string) error {
 	</html>
 	`, resetURL)
 
-	return sendEmail(to, "Restablece tu contraseña", htmlContent)
+	return m.sendEmail(ctx, to, "Restablece tu contraseña", htmlContent)
+}
+
+// SendEmailChangeConfirmation envía a la nueva dirección el enlace para confirmar el cambio de email
+func (m *Mailer) SendEmailChangeConfirmation(ctx context.Context, to, token string) error {
+	frontendURL := m.cfg.FrontendURL
+	if to == "" || token == "" {
+		return fmt.Errorf("parámetros inválidos: email o token vacío")
+	}
+	confirmURL := fmt.Sprintf("%s/confirmar-cambio-email?token=%s", strings.TrimSuffix(frontendURL, "/"), token)
+
+	htmlContent := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<body>
+		<h1>Confirma tu nuevo email</h1>
+		<p>Solicitaste usar esta dirección en tu cuenta. Haz clic en el siguiente enlace para confirmar el cambio:</p>
+		<a href="%s" style="background-color: #007bff; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">
+			Confirmar email
+		</a>
+		<p>Si no solicitaste este cambio, ignora este mensaje.</p>
+	</body>
+	</html>
+	`, confirmURL)
+
+	return m.sendEmail(ctx, to, "Confirma tu nuevo email", htmlContent)
+}
+
+// SendEmailChangedNotification avisa a la dirección anterior que el email de la cuenta fue cambiado
+func (m *Mailer) SendEmailChangedNotification(ctx context.Context, to, newEmail string) error {
+	if to == "" || newEmail == "" {
+		return fmt.Errorf("parámetros inválidos: email vacío")
+	}
+
+	htmlContent := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<body>
+		<h1>El email de tu cuenta fue cambiado</h1>
+		<p>El email de acceso de tu cuenta ahora es <strong>%s</strong>.</p>
+		<p>Si no realizaste este cambio, contacta de inmediato a soporte.</p>
+	</body>
+	</html>
+	`, html.EscapeString(newEmail))
+
+	return m.sendEmail(ctx, to, "El email de tu cuenta fue cambiado", htmlContent)
+}
+
+// SendInvitationEmail envía el enlace de activación a un usuario invitado por un administrador
+func (m *Mailer) SendInvitationEmail(ctx context.Context, to, nombre, token string, expiresAt time.Time) error {
+	frontendURL := m.cfg.FrontendURL
+	if to == "" || token == "" {
+		return fmt.Errorf("parámetros inválidos: email o token vacío")
+	}
+	activateURL := fmt.Sprintf("%s/activar-cuenta?token=%s", strings.TrimSuffix(frontendURL, "/"), token)
+
+	htmlContent := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<body>
+		<h1>Hola %s, te invitamos a Cotizador Productos EML</h1>
+		<p>Se creó una cuenta para ti. Haz clic en el siguiente enlace para elegir tu contraseña y activarla:</p>
+		<a href="%s" style="background-color: #007bff; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">
+			Activar cuenta
+		</a>
+		<p>El enlace solo puede usarse una vez y vence el %s.</p>
+	</body>
+	</html>
+	`, html.EscapeString(nombre), activateURL, expiresAt.Format("02-01-2006 15:04"))
+
+	return m.sendEmail(ctx, to, "Activa tu cuenta", htmlContent)
+}
+
+// SendAccountDeletionConfirmation envía el enlace para confirmar la eliminación de la cuenta
+func (m *Mailer) SendAccountDeletionConfirmation(ctx context.Context, to, token string) error {
+	frontendURL := m.cfg.FrontendURL
+	if to == "" || token == "" {
+		return fmt.Errorf("parámetros inválidos: email o token vacío")
+	}
+	confirmURL := fmt.Sprintf("%s/confirmar-eliminacion-cuenta?token=%s", strings.TrimSuffix(frontendURL, "/"), token)
+
+	htmlContent := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<body>
+		<h1>Confirma la eliminación de tu cuenta</h1>
+		<p>Solicitaste eliminar tu cuenta. Al confirmarlo se borrarán tus datos personales, direcciones y credenciales de acceso.</p>
+		<p>Los pedidos realizados se conservan por obligaciones contables.</p>
+		<a href="%s" style="background-color: #dc3545; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">
+			Eliminar mi cuenta
+		</a>
+		<p>El enlace vence en 1 hora. Si no solicitaste la eliminación, ignora este mensaje y cambia tu contraseña.</p>
+	</body>
+	</html>
+	`, confirmURL)
+
+	return m.sendEmail(ctx, to, "Confirma la eliminación de tu cuenta", htmlContent)
+}
+
+// SendCompanyInvitationEmail avisa a un usuario que un administrador lo invitó a unirse a una empresa
+func (m *Mailer) SendCompanyInvitationEmail(ctx context.Context, to, razonSocial string) error {
+	frontendURL := m.cfg.FrontendURL
+	if to == "" {
+		return fmt.Errorf("parámetros inválidos: email vacío")
+	}
+	invitacionesURL := fmt.Sprintf("%s/empresas/invitaciones", strings.TrimSuffix(frontendURL, "/"))
+
+	htmlContent := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<body>
+		<h1>Te invitaron a unirte a %s</h1>
+		<p>Un administrador de la empresa te invitó a comprar a su nombre. Inicia sesión para aceptar o rechazar la invitación:</p>
+		<a href="%s" style="background-color: #007bff; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">
+			Ver invitaciones
+		</a>
+		<p>Si no reconoces esta empresa, rechaza la invitación o ignora este mensaje.</p>
+	</body>
+	</html>
+	`, html.EscapeString(razonSocial), invitacionesURL)
+
+	return m.sendEmail(ctx, to, "Invitación a una empresa", htmlContent)
+}
+
+// NormalizeEmail deja el email sin espacios y en minúsculas, la forma en que se guarda y se compara
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
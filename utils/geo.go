@@ -0,0 +1,137 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+)
+
+//go:embed data/regiones_comunas.json
+var regionesComunasFile []byte
+
+// Region es una región de Chile identificada por su código CUT
+type Region struct {
+	Codigo      string   `json:"codigo"`
+	Nombre      string   `json:"nombre"`
+	Abreviatura string   `json:"abreviatura"`
+	Alias       []string `json:"-"`
+	Comunas     []Comuna `json:"-"`
+}
+
+// Comuna es una comuna de Chile identificada por su código CUT
+type Comuna struct {
+	Codigo       string   `json:"codigo"`
+	Nombre       string   `json:"nombre"`
+	RegionCodigo string   `json:"region_codigo"`
+	Alias        []string `json:"-"`
+}
+
+var (
+	regiones         = loadRegiones(regionesComunasFile)
+	regionesPorClave = make(map[string]*Region)
+	comunasPorClave  = make(map[string]*Comuna)
+)
+
+func init() {
+	for i := range regiones {
+		region := &regiones[i]
+		regionesPorClave[region.Codigo] = region
+		regionesPorClave[normalizeGeoName(region.Nombre)] = region
+		regionesPorClave[normalizeGeoName(region.Abreviatura)] = region
+		for _, alias := range region.Alias {
+			regionesPorClave[normalizeGeoName(alias)] = region
+		}
+		for j := range region.Comunas {
+			comuna := &region.Comunas[j]
+			comunasPorClave[comuna.Codigo] = comuna
+			comunasPorClave[normalizeGeoName(comuna.Nombre)] = comuna
+			for _, alias := range comuna.Alias {
+				comunasPorClave[normalizeGeoName(alias)] = comuna
+			}
+		}
+	}
+}
+
+func loadRegiones(data []byte) []Region {
+	var raw []struct {
+		Codigo      string   `json:"codigo"`
+		Nombre      string   `json:"nombre"`
+		Abreviatura string   `json:"abreviatura"`
+		Alias       []string `json:"alias"`
+		Comunas     []struct {
+			Codigo string   `json:"codigo"`
+			Nombre string   `json:"nombre"`
+			Alias  []string `json:"alias"`
+		} `json:"comunas"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		panic("regiones_comunas.json inválido: " + err.Error())
+	}
+
+	result := make([]Region, 0, len(raw))
+	for _, r := range raw {
+		region := Region{Codigo: r.Codigo, Nombre: r.Nombre, Abreviatura: r.Abreviatura, Alias: r.Alias}
+		for _, c := range r.Comunas {
+			region.Comunas = append(region.Comunas, Comuna{Codigo: c.Codigo, Nombre: c.Nombre, RegionCodigo: r.Codigo, Alias: c.Alias})
+		}
+		result = append(result, region)
+	}
+	return result
+}
+
+// geoNameReplacer quita tildes y signos para comparar nombres escritos de distintas formas
+var geoNameReplacer = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"'", "", ".", "", "-", " ",
+)
+
+// normalizeGeoName lleva un nombre a minúsculas sin tildes ni espacios repetidos
+func normalizeGeoName(name string) string {
+	name = geoNameReplacer.Replace(strings.ToLower(strings.TrimSpace(name)))
+	name = strings.Join(strings.Fields(name), " ")
+	// "Región de Valparaíso" y "Region Metropolitana" se buscan sin el prefijo
+	for _, prefix := range []string{"region de ", "region del ", "region "} {
+		if rest, found := strings.CutPrefix(name, prefix); found {
+			return rest
+		}
+	}
+	return name
+}
+
+// Regiones devuelve las regiones de norte a sur
+func Regiones() []Region {
+	return regiones
+}
+
+// FindRegion busca una región por código, nombre o abreviatura
+func FindRegion(value string) (*Region, bool) {
+	if region, ok := regionesPorClave[strings.TrimSpace(value)]; ok {
+		return region, true
+	}
+	region, ok := regionesPorClave[normalizeGeoName(value)]
+	return region, ok
+}
+
+// FindComuna busca una comuna por código o nombre
+func FindComuna(value string) (*Comuna, bool) {
+	if comuna, ok := comunasPorClave[strings.TrimSpace(value)]; ok {
+		return comuna, true
+	}
+	comuna, ok := comunasPorClave[normalizeGeoName(value)]
+	return comuna, ok
+}
+
+// ResolveComuna valida una comuna y, si se indica la región, que pertenezca a ella
+func ResolveComuna(comunaValue, regionValue string) (*Comuna, bool) {
+	comuna, ok := FindComuna(comunaValue)
+	if !ok {
+		return nil, false
+	}
+	if strings.TrimSpace(regionValue) != "" {
+		region, ok := FindRegion(regionValue)
+		if !ok || region.Codigo != comuna.RegionCodigo {
+			return nil, false
+		}
+	}
+	return comuna, true
+}
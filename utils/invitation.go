@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// GenerateInvitationToken genera el token de un enlace de invitación y el hash con el que se guarda
+func GenerateInvitationToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generando token de invitación: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashInvitationToken(token), nil
+}
+
+// HashInvitationToken calcula el hash con el que se busca la invitación
+func HashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,38 +1,112 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Genera token de verificación (puedes reutilizarlo para otros tipos de tokens)
-func GenerateJWT(userID int, email, rol, secret string, expiresIn time.Duration, tokenType string) (string, error) {
+func (k *JWTKeys) GenerateJWT(userID int, email, rol string, expiresIn time.Duration, tokenType string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"sub":   userID,
 		"email": email,
 		"rol":   rol,
-		"exp":   time.Now().Add(expiresIn).Unix(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(expiresIn).Unix(),
 		"type":  tokenType,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return k.signToken(claims)
 }
 
-// Valida y parsea un token (útil para el endpoint de verificación)
-func ParseJWT(tokenString, secret string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// GenerateMFAPendingJWT genera el token del segundo paso de inicio de sesión con 2FA. Incluye un identificador
+// único en "jti" para que el servidor pueda aceptarlo una sola vez y descartar los emitidos antes
+func (k *JWTKeys) GenerateMFAPendingJWT(userID int, email, rol string, expiresIn time.Duration) (token, jti string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	jti = hex.EncodeToString(b)
 
-	if err != nil {
-		return nil, err
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":   userID,
+		"email": email,
+		"rol":   rol,
+		"jti":   jti,
+		"iat":   now.Unix(),
+		"exp":   now.Add(expiresIn).Unix(),
+		"type":  "mfa_pending",
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	token, err = k.signToken(claims)
+	return token, jti, err
+}
+
+// GenerateEmailChangeJWT genera el token para confirmar un cambio de email. Lleva la nueva dirección en "email"
+// y la actual en "email_actual", para que el enlace deje de servir si el email cambia por otra vía
+func (k *JWTKeys) GenerateEmailChangeJWT(userID int, currentEmail, newEmail, rol string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":          userID,
+		"email":        newEmail,
+		"email_actual": currentEmail,
+		"rol":          rol,
+		"iat":          now.Unix(),
+		"exp":          now.Add(expiresIn).Unix(),
+		"type":         "change_email",
+	}
+
+	return k.signToken(claims)
+}
+
+// Valida y parsea un token (útil para el endpoint de verificación)
+func (k *JWTKeys) ParseJWT(tokenString string) (jwt.MapClaims, error) {
+	return k.parseToken(tokenString)
+}
+
+// Actor identifica al administrador que actúa en nombre de otro usuario (claim "act", RFC 8693)
+type Actor struct {
+	UserID    int
+	Email     string
+	SessionID int
+}
+
+// GenerateImpersonationJWT genera un token de acceso del usuario suplantado que incluye al actor en el claim "act"
+func (k *JWTKeys) GenerateImpersonationJWT(userID int, email, rol string, actor Actor, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":   userID,
+		"email": email,
+		"rol":   rol,
+		"iat":   now.Unix(),
+		"exp":   now.Add(expiresIn).Unix(),
+		"type":  "access",
+		"act": map[string]interface{}{
+			"sub":   actor.UserID,
+			"email": actor.Email,
+			"sid":   actor.SessionID,
+		},
 	}
 
-	return nil, jwt.ErrInvalidKey
+	return k.signToken(claims)
+}
+
+// parseActor extrae el actor del claim "act" si el token es de suplantación
+func parseActor(claims jwt.MapClaims) (*Actor, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	sub, subOk := act["sub"].(float64)
+	email, emailOk := act["email"].(string)
+	sid, _ := act["sid"].(float64)
+	if !subOk || !emailOk {
+		return nil, false
+	}
+	return &Actor{UserID: int(sub), Email: email, SessionID: int(sid)}, true
 }
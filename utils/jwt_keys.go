@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"cotizador-productos-eml/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey es una clave de firma identificada por su kid. Las claves retiradas solo tienen la parte pública
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// JWTKeys agrupa la clave activa de firma y todas las claves aceptadas al verificar.
+// Se carga una vez con LoadJWTKeys y se pasa a los handlers y middlewares que emiten o validan tokens
+type JWTKeys struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+	// secret firma con HS256 cuando no hay claves asimétricas. Con claves asimétricas solo verifica
+	// los tokens antiguos sin kid, y únicamente hasta legacyUntil
+	secret      []byte
+	legacyUntil time.Time
+	// issuer va en "iss" de todos los tokens. Los access tokens llevan audience en "aud" y los demás tipos
+	// (refresh, verificación, 2FA...) llevan issuer, porque solo este servicio debe aceptarlos
+	issuer   string
+	audience string
+}
+
+// accessTokenType es el valor de la cabecera "typ" de los access tokens (RFC 9068)
+const accessTokenType = "at+jwt"
+
+// LoadJWTKeys carga las claves de firma según la configuración.
+//
+// Si JWT_KEYS_DIR está vacío se firma con HS256 usando JWT_SECRET. Si no, cada archivo <kid>.pem
+// del directorio es una clave: las privadas (PKCS#8 o PKCS#1, RSA o Ed25519) pueden firmar y las
+// públicas (PKIX) solo verifican. JWT_SIGNING_KID indica la clave con la que se firman los tokens nuevos
+// y JWT_LEGACY_HS256_UNTIL hasta cuándo se aceptan los tokens HS256 emitidos antes de migrar.
+func LoadJWTKeys(cfg config.JWTConfig) (*JWTKeys, error) {
+	set := &JWTKeys{
+		keys:        make(map[string]*jwtKey),
+		secret:      []byte(cfg.Secret),
+		legacyUntil: cfg.LegacyHS256Until,
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+	}
+
+	dir := cfg.KeysDir
+	if dir == "" {
+		if len(set.secret) == 0 {
+			return nil, errors.New("JWT_SECRET o JWT_KEYS_DIR debe estar configurado")
+		}
+		return set, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo JWT_KEYS_DIR: %w", err)
+	}
+	for _, file := range files {
+		key, err := loadJWTKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[key.kid] = key
+	}
+
+	signingKID := cfg.SigningKID
+	if signingKID == "" {
+		return nil, errors.New("JWT_SIGNING_KID es requerido cuando se usa JWT_KEYS_DIR")
+	}
+	signing, ok := set.keys[signingKID]
+	if !ok || signing.private == nil {
+		return nil, fmt.Errorf("no se encontró la clave privada %q en JWT_KEYS_DIR", signingKID)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+func loadJWTKeyFile(file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la clave %s: %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("la clave %s no es un PEM válido", file)
+	}
+
+	key := &jwtKey{kid: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("tipo de PEM no soportado en %s: %s", file, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parseando la clave %s: %w", file, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("algoritmo de clave no soportado en %s (usa RSA o Ed25519)", file)
+	}
+
+	if rsaKey, ok := key.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("la clave RSA %s debe tener al menos 2048 bits", file)
+	}
+	return key, nil
+}
+
+// audienceFor devuelve la audiencia que corresponde a un tipo de token
+func (k *JWTKeys) audienceFor(tokenType string) string {
+	if tokenType == "access" {
+		return k.audience
+	}
+	return k.issuer
+}
+
+// signToken completa "iss" y "aud" según el claim "type" y firma los claims con la clave activa.
+// Solo los access tokens llevan la cabecera typ "at+jwt"
+func (k *JWTKeys) signToken(claims jwt.MapClaims) (string, error) {
+	tokenType, _ := claims["type"].(string)
+	claims["iss"] = k.issuer
+	claims["aud"] = k.audienceFor(tokenType)
+
+	method := jwt.SigningMethod(jwt.SigningMethodHS256)
+	if k.signing != nil {
+		method = k.signing.method
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if tokenType == "access" {
+		token.Header["typ"] = accessTokenType
+	}
+	if k.signing == nil {
+		return token.SignedString(k.secret)
+	}
+	token.Header["kid"] = k.signing.kid
+	return token.SignedString(k.signing.private)
+}
+
+// parseToken verifica la firma, el emisor y que la audiencia y la cabecera typ correspondan al tipo de token,
+// para que un token de otro tipo firmado con la misma clave no pueda usarse como access token ni al revés
+func (k *JWTKeys) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyFunc, jwt.WithIssuer(k.issuer))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	tokenType, _ := claims["type"].(string)
+	aud, err := claims.GetAudience()
+	if err != nil || !slices.Equal(aud, jwt.ClaimStrings{k.audienceFor(tokenType)}) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	typ, _ := token.Header["typ"].(string)
+	if (tokenType == "access") != (typ == accessTokenType) {
+		return nil, fmt.Errorf("%w: cabecera typ inválida", jwt.ErrTokenInvalidClaims)
+	}
+	return claims, nil
+}
+
+// keyFunc resuelve la clave de verificación a partir del kid del token
+func (k *JWTKeys) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens sin kid: firmados con HS256. Con una clave asimétrica activa solo se aceptan durante la migración,
+		// para que quien conozca JWT_SECRET no pueda seguir emitiendo tokens
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(k.secret) == 0 {
+			return nil, fmt.Errorf("método de firma inválido")
+		}
+		if k.signing != nil && !time.Now().Before(k.legacyUntil) {
+			return nil, fmt.Errorf("los tokens HS256 ya no se aceptan")
+		}
+		return k.secret, nil
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid desconocido: %s", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("método de firma inválido")
+	}
+	return key.public, nil
+}
+
+// JWK es la representación pública de una clave según RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// PublicJWKS devuelve las claves públicas vigentes (activa y retiradas) para publicarlas en el JWKS.
+// Con HS256 la lista está vacía porque el secreto no puede publicarse
+func (k *JWTKeys) PublicJWKS() []JWK {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		key := k.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
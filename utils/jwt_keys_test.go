@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"cotizador-productos-eml/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+// writeEd25519Key guarda una clave Ed25519 en dir/<kid>.pem; si public es true solo guarda la parte pública
+func writeEd25519Key(t *testing.T, dir, kid string, public bool) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	if public {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(pub)
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(priv)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testJWTConfig(dir, kid string) config.JWTConfig {
+	return config.JWTConfig{
+		Secret:     testJWTSecret,
+		KeysDir:    dir,
+		SigningKID: kid,
+		Issuer:     "cotizador-test",
+		Audience:   "cotizador-test-api",
+	}
+}
+
+func mustLoadJWTKeys(t *testing.T, cfg config.JWTConfig) *JWTKeys {
+	t.Helper()
+	keys, err := LoadJWTKeys(cfg)
+	if err != nil {
+		t.Fatalf("LoadJWTKeys: %v", err)
+	}
+	return keys
+}
+
+func mustGenerateJWT(t *testing.T, keys *JWTKeys, tokenType string) string {
+	t.Helper()
+	token, err := keys.GenerateJWT(1, "juana@example.com", RolCliente, time.Minute, tokenType)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	return token
+}
+
+func TestJWTKeysRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2025-01", false)
+	writeEd25519Key(t, dir, "2025-06", false)
+
+	oldKeys := mustLoadJWTKeys(t, testJWTConfig(dir, "2025-01"))
+	oldToken := mustGenerateJWT(t, oldKeys, "access")
+
+	// Tras rotar, los tokens firmados con la clave anterior siguen siendo válidos mientras esté en el directorio
+	newKeys := mustLoadJWTKeys(t, testJWTConfig(dir, "2025-06"))
+	if _, err := newKeys.ParseJWT(oldToken); err != nil {
+		t.Errorf("un token firmado con el kid anterior fue rechazado: %v", err)
+	}
+	newToken := mustGenerateJWT(t, newKeys, "access")
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "2025-06" {
+		t.Errorf("kid del token nuevo = %v, se esperaba 2025-06", kid)
+	}
+
+	// Reemplazar la clave anterior por su parte pública sigue permitiendo verificar, pero no firmar
+	writeEd25519Key(t, dir, "2025-01", true)
+	if _, err := LoadJWTKeys(testJWTConfig(dir, "2025-01")); err == nil {
+		t.Error("LoadJWTKeys aceptó firmar con una clave pública")
+	}
+
+	// Un token con un kid que no está en el directorio se rechaza
+	otherDir := t.TempDir()
+	writeEd25519Key(t, otherDir, "desconocida", false)
+	unknownToken := mustGenerateJWT(t, mustLoadJWTKeys(t, testJWTConfig(otherDir, "desconocida")), "access")
+	if _, err := newKeys.ParseJWT(unknownToken); err == nil {
+		t.Error("se aceptó un token con un kid desconocido")
+	}
+
+	// Un token con un kid conocido pero firmado con otro algoritmo se rechaza
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1, "type": "access", "iss": "cotizador-test", "aud": "cotizador-test-api",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = "2025-06"
+	forged.Header["typ"] = "at+jwt"
+	forgedToken, err := forged.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newKeys.ParseJWT(forgedToken); err == nil {
+		t.Error("se aceptó un token HS256 con el kid de una clave asimétrica")
+	}
+}
+
+func TestJWTKeysLegacyHS256(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2025-06", false)
+
+	hsCfg := testJWTConfig("", "")
+	legacyToken := mustGenerateJWT(t, mustLoadJWTKeys(t, hsCfg), "access")
+
+	tests := []struct {
+		name        string
+		legacyUntil time.Time
+		keysDir     string
+		valid       bool
+	}{
+		{"solo HS256", time.Time{}, "", true},
+		{"asimétrica durante la migración", time.Now().Add(time.Hour), dir, true},
+		{"asimétrica pasada la migración", time.Now().Add(-time.Second), dir, false},
+		{"asimétrica sin migración", time.Time{}, dir, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := hsCfg
+			cfg.LegacyHS256Until = tt.legacyUntil
+			if tt.keysDir != "" {
+				cfg.KeysDir, cfg.SigningKID = tt.keysDir, "2025-06"
+			}
+			_, err := mustLoadJWTKeys(t, cfg).ParseJWT(legacyToken)
+			if (err == nil) != tt.valid {
+				t.Errorf("ParseJWT(token HS256 sin kid) error = %v, se esperaba válido = %v", err, tt.valid)
+			}
+		})
+	}
+
+	// Un token HS256 firmado con otro secreto nunca es válido
+	otherCfg := hsCfg
+	otherCfg.Secret = "fedcba9876543210fedcba9876543210"
+	if _, err := mustLoadJWTKeys(t, hsCfg).ParseJWT(mustGenerateJWT(t, mustLoadJWTKeys(t, otherCfg), "access")); err == nil {
+		t.Error("se aceptó un token HS256 firmado con otro secreto")
+	}
+}
+
+func TestJWTKeysIssuerAudienceAndType(t *testing.T) {
+	cfg := testJWTConfig("", "")
+	keys := mustLoadJWTKeys(t, cfg)
+
+	for _, tokenType := range []string{"access", "refresh", "verify_email", "reset_password"} {
+		claims, err := keys.ParseJWT(mustGenerateJWT(t, keys, tokenType))
+		if err != nil {
+			t.Errorf("ParseJWT(%s) = %v", tokenType, err)
+			continue
+		}
+		wantAud := cfg.Issuer
+		if tokenType == "access" {
+			wantAud = cfg.Audience
+		}
+		if claims["iss"] != cfg.Issuer || claims["aud"] != wantAud {
+			t.Errorf("token %s: iss = %v, aud = %v, se esperaba %s, %s", tokenType, claims["iss"], claims["aud"], cfg.Issuer, wantAud)
+		}
+	}
+
+	sign := func(header map[string]interface{}, claims jwt.MapClaims) string {
+		claims["sub"] = 1
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		signed, err := token.SignedString([]byte(testJWTSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	atJWT := map[string]interface{}{"typ": "at+jwt"}
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		claims jwt.MapClaims
+	}{
+		{"access sin typ at+jwt", nil, jwt.MapClaims{"type": "access", "iss": cfg.Issuer, "aud": cfg.Audience}},
+		{"refresh con typ at+jwt", atJWT, jwt.MapClaims{"type": "refresh", "iss": cfg.Issuer, "aud": cfg.Issuer}},
+		{"access con la audiencia interna", atJWT, jwt.MapClaims{"type": "access", "iss": cfg.Issuer, "aud": cfg.Issuer}},
+		{"reset con la audiencia de la API", nil, jwt.MapClaims{"type": "reset_password", "iss": cfg.Issuer, "aud": cfg.Audience}},
+		{"otro emisor", atJWT, jwt.MapClaims{"type": "access", "iss": "otro", "aud": cfg.Audience}},
+		{"sin iss ni aud", atJWT, jwt.MapClaims{"type": "access"}},
+		{"varias audiencias", atJWT, jwt.MapClaims{"type": "access", "iss": cfg.Issuer, "aud": []string{cfg.Audience, "otra"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.ParseJWT(sign(tt.header, tt.claims)); err == nil {
+				t.Error("ParseJWT aceptó el token")
+			}
+		})
+	}
+}
+
+func TestLoadJWTKeysErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2025-06", false)
+
+	weakDir := t.TempDir()
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)})
+	if err := os.WriteFile(filepath.Join(weakDir, "debil.pem"), weakPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	invalidDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(invalidDir, "rota.pem"), []byte("no es un PEM"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+	}{
+		{"sin secreto ni claves", config.JWTConfig{}},
+		{"sin JWT_SIGNING_KID", testJWTConfig(dir, "")},
+		{"kid inexistente", testJWTConfig(dir, "2024-01")},
+		{"RSA de menos de 2048 bits", testJWTConfig(weakDir, "debil")},
+		{"PEM inválido", testJWTConfig(invalidDir, "rota")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadJWTKeys(tt.cfg); err == nil {
+				t.Error("LoadJWTKeys no devolvió error")
+			}
+		})
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+	if jwks := mustLoadJWTKeys(t, testJWTConfig("", "")).PublicJWKS(); len(jwks) != 0 {
+		t.Errorf("con HS256 el JWKS debería estar vacío, tiene %d claves", len(jwks))
+	}
+
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2025-06", false)
+	writeEd25519Key(t, dir, "2025-01", true)
+	jwks := mustLoadJWTKeys(t, testJWTConfig(dir, "2025-06")).PublicJWKS()
+	if len(jwks) != 2 || jwks[0].Kid != "2025-01" || jwks[1].Kid != "2025-06" {
+		t.Fatalf("PublicJWKS = %+v, se esperaban las claves 2025-01 y 2025-06", jwks)
+	}
+	for _, jwk := range jwks {
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.Use != "sig" || jwk.X == "" {
+			t.Errorf("JWK incompleta: %+v", jwk)
+		}
+	}
+}
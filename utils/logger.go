@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader es la cabecera con la que se recibe y se devuelve el ID de la petición
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen limita el largo de un X-Request-ID recibido para no registrar valores arbitrarios
+const maxRequestIDLen = 128
+
+// redacted reemplaza los valores sensibles en los logs
+const redacted = "[REDACTED]"
+
+// requestIDCtxKey guarda el ID de la petición en el contexto de la solicitud HTTP
+type requestIDCtxKey struct{}
+
+var (
+	// sensitiveKeys son las claves de atributos cuyo valor nunca se registra
+	sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "api_key", "apikey", "rut"}
+
+	// sensitivePatterns se buscan en los textos registrados: JWT, API keys, parámetros token= o password=
+	// (también refresh_token=, new_password=...), contraseñas en URLs de conexión y RUTs
+	sensitivePatterns = []struct {
+		re          *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+		{regexp.MustCompile(`\beml_[0-9a-f]{8}_[A-Za-z0-9_-]+`), redacted},
+		{regexp.MustCompile(`(?i)\b(\w*(?:token|password))=[^&\s]+`), "${1}=" + redacted},
+		{regexp.MustCompile(`(://[^/\s:@]+:)[^@\s/]+@`), "${1}" + redacted + "@"},
+		{regexp.MustCompile(`\b\d{1,2}\.?\d{3}\.?\d{3}-[\dkK]\b`), redacted},
+	}
+
+	validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+)
+
+// SetupLogger configura slog con salida JSON como logger por defecto. Los mensajes de log.Printf también pasan por él
+func SetupLogger(level slog.Level) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// contextHandler agrega a cada registro el ID de la petición, el usuario autenticado y la traza activa, si el contexto los tiene
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		r.AddAttrs(slog.String("request_id", requestID))
+	}
+	// Con un *gin.Context, Value busca en las claves que guarda AuthMiddleware
+	if userID, ok := ctx.Value("userID").(int); ok {
+		r.AddAttrs(slog.Int("user_id", userID))
+	}
+	if actorID, ok := ctx.Value("actorID").(int); ok {
+		r.AddAttrs(slog.Int("actor_id", actorID))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr oculta los atributos con claves sensibles y los secretos o RUTs incluidos en textos y errores
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	// Los identificadores (api_key_id, token_id) no son secretos
+	key := strings.ToLower(a.Key)
+	if !strings.HasSuffix(key, "_id") {
+		for _, s := range sensitiveKeys {
+			if strings.Contains(key, s) {
+				return slog.String(a.Key, redacted)
+			}
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(RedactString(err.Error()))
+		}
+	}
+	return a
+}
+
+// RedactString reemplaza tokens, API keys, contraseñas y RUTs por [REDACTED]
+func RedactString(s string) string {
+	for _, p := range sensitivePatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// RequestIDFromContext devuelve el ID de la petición guardado por RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDCtxKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value("requestID").(string); ok {
+		return id
+	}
+	return ""
+}
+
+// RequestIDMiddleware asigna un ID a cada petición. Respeta el X-Request-ID recibido si es válido y lo devuelve en la respuesta
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if len(requestID) > maxRequestIDLen || !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("requestID", requestID)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDCtxKey{}, requestID))
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// RequestLogger registra cada petición con su ruta, estado y latencia. No registra la query string,
+// que puede incluir tokens de verificación
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c, level, "petición HTTP", attrs...)
+	}
+}
+
+// RecoveryMiddleware responde 500 ante un panic y lo registra con el ID de la petición
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c, "panic recuperado", "panic", err, "method", c.Request.Method, "path", c.Request.URL.Path, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error interno del servidor"})
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/uptrace/bun"
+)
+
+// metricsNamespace es el prefijo de todas las métricas de la aplicación
+const metricsNamespace = "cotizador"
+
+// estadoOtro agrupa en las métricas los estados de pedido que no están en estadosConocidos
+const estadoOtro = "otro"
+
+// estadosConocidos son los estados de pedido que se usan como etiqueta. Los estados son texto libre,
+// por lo que cualquier otro valor se cuenta como "otro" para no crear series sin límite
+var estadosConocidos = map[string]bool{
+	"pendiente":  true,
+	"confirmado": true,
+	"pagado":     true,
+	"en_proceso": true,
+	"enviado":    true,
+	"entregado":  true,
+	"cancelado":  true,
+	"rechazado":  true,
+}
+
+// MetricsRegistry contiene las métricas que expone /metrics
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = promauto.With(MetricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Peticiones HTTP por método, plantilla de ruta y estado.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.With(MetricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duración de las peticiones HTTP por método y plantilla de ruta.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	emailsTotal = promauto.With(MetricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "emails_total",
+		Help:      "Correos enviados con Brevo por resultado (ok o error).",
+	}, []string{"resultado"})
+
+	pedidosCreadosTotal = promauto.With(MetricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pedidos_creados_total",
+		Help:      "Pedidos creados por estado inicial.",
+	}, []string{"estado"})
+
+	pedidosCambiosEstadoTotal = promauto.With(MetricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pedidos_cambios_estado_total",
+		Help:      "Cambios de estado de pedidos por estado nuevo.",
+	}, []string{"estado"})
+
+	loginFallidosTotal = promauto.With(MetricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "login_fallidos_total",
+		Help:      "Inicios de sesión fallidos por motivo.",
+	}, []string{"motivo"})
+)
+
+// Motivos de la métrica de inicios de sesión fallidos
+const (
+	LoginFalloCredenciales = "credenciales"
+	LoginFalloNoVerificado = "no_verificado"
+	LoginFalloMFA          = "mfa"
+	LoginFalloMFABloqueado = "mfa_bloqueado"
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterDBMetrics expone las estadísticas del pool de conexiones y la cantidad de pedidos por estado
+func RegisterDBMetrics(db *bun.DB) {
+	MetricsRegistry.MustRegister(
+		collectors.NewDBStatsCollector(db.DB, "postgres"),
+		&pedidosPorEstadoCollector{db: db},
+	)
+}
+
+// MetricsMiddleware registra la cantidad y duración de las peticiones por plantilla de ruta
+// (por ejemplo /order/:id), para no crear una serie por cada ID
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "no_encontrada"
+		}
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsTokenMiddleware exige el token de /metrics en la cabecera Authorization: Bearer. Sin token configurado no restringe
+func MetricsTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token de métricas inválido"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RecordPedidoCreado cuenta un pedido nuevo
+func RecordPedidoCreado(estado string) {
+	pedidosCreadosTotal.WithLabelValues(estadoLabel(estado)).Inc()
+}
+
+// RecordCambioEstadoPedido cuenta un cambio de estado de un pedido
+func RecordCambioEstadoPedido(estado string) {
+	pedidosCambiosEstadoTotal.WithLabelValues(estadoLabel(estado)).Inc()
+}
+
+// RecordLoginFallido cuenta un inicio de sesión fallido con uno de los motivos LoginFallo*
+func RecordLoginFallido(motivo string) {
+	loginFallidosTotal.WithLabelValues(motivo).Inc()
+}
+
+// recordEmail cuenta un envío de correo según su resultado
+func recordEmail(err error) {
+	resultado := "ok"
+	if err != nil {
+		resultado = "error"
+	}
+	emailsTotal.WithLabelValues(resultado).Inc()
+}
+
+// estadoLabel normaliza el estado de un pedido a uno de estadosConocidos o a "otro"
+func estadoLabel(estado string) string {
+	estado = strings.ToLower(strings.TrimSpace(estado))
+	if estadosConocidos[estado] {
+		return estado
+	}
+	return estadoOtro
+}
+
+// pedidosPorEstadoCollector consulta la cantidad actual de pedidos por estado en cada scrape
+type pedidosPorEstadoCollector struct {
+	db *bun.DB
+}
+
+var pedidosPorEstadoDesc = prometheus.NewDesc(
+	metricsNamespace+"_pedidos",
+	"Pedidos existentes por estado.",
+	[]string{"estado"}, nil,
+)
+
+func (p *pedidosPorEstadoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pedidosPorEstadoDesc
+}
+
+func (p *pedidosPorEstadoCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var filas []struct {
+		Estado   string
+		Cantidad int64
+	}
+	err := p.db.NewSelect().
+		Table("pedidos").
+		Column("estado").
+		ColumnExpr("count(*) AS cantidad").
+		Group("estado").
+		Scan(ctx, &filas)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("Error consultando pedidos por estado para métricas", "error", err)
+		ch <- prometheus.NewInvalidMetric(pedidosPorEstadoDesc, err)
+		return
+	}
+
+	// Se agrupa después de normalizar para no repetir etiquetas
+	cantidades := make(map[string]int64)
+	for _, f := range filas {
+		cantidades[estadoLabel(f.Estado)] += f.Cantidad
+	}
+	for estado, cantidad := range cantidades {
+		ch <- prometheus.MustNewConstMetric(pedidosPorEstadoDesc, prometheus.GaugeValue, float64(cantidad), estado)
+	}
+}
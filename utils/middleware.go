@@ -1,32 +1,78 @@
 package utils
 
 import (
-	"fmt"
+	"cotizador-productos-eml/models"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/uptrace/bun"
 )
 
-// AuthMiddleware es un middleware que protege las rutas privadas
-func AuthMiddleware() gin.HandlerFunc {
+// Métodos de autenticación que AuthMiddleware guarda en el contexto como "authMethod"
+const (
+	AuthMethodCookie = "cookie"
+	AuthMethodBearer = "bearer"
+	AuthMethodAPIKey = "api_key"
+)
+
+// AuthMiddleware es un middleware que protege las rutas privadas.
+// Acepta el token de acceso en la cabecera Authorization o la cookie access_token. Las API keys (X-API-Key)
+// solo se aceptan si la ruta declara scopes, y la key debe incluirlos todos; sin scopes se rechazan
+func AuthMiddleware(db *bun.DB, keys *JWTKeys, scopes ...string) gin.HandlerFunc {
+	return tokenMiddleware(db, keys, scopes, "access")
+}
+
+// MFAEnrollMiddleware acepta además el token "mfa_enroll" que emite Login cuando
+// un usuario debe configurar 2FA antes de poder iniciar sesión. No acepta API keys
+func MFAEnrollMiddleware(db *bun.DB, keys *JWTKeys) gin.HandlerFunc {
+	return tokenMiddleware(db, keys, nil, "access", "mfa_enroll")
+}
+
+// tokenMiddleware valida el token de la petición y solo acepta los tipos indicados.
+// Las API keys solo se aceptan si la ruta declara scopes. Con un JWT el usuario se carga desde la base de datos,
+// por lo que un usuario eliminado pierde el acceso y un cambio de rol se aplica sin esperar a que expire el token
+func tokenMiddleware(db *bun.DB, keys *JWTKeys, scopes []string, allowedTypes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var secret = []byte(os.Getenv("JWT_SECRET"))
 		var tokenString string
+		var authMethod string
 
-		// Primero intenta obtener el token desde la cookie
-		cookieToken, err := c.Cookie("access_token")
-		if err == nil {
-			tokenString = cookieToken
-		} else {
-			// Si no está en la cookie, intenta obtenerlo desde la cabecera Authorization
-			authHeader := c.GetHeader("Authorization")
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				tokenString = parts[1]
+		// Las cabeceras Authorization y X-API-Key tienen prioridad sobre la cookie: un sitio externo no
+		// puede enviarlas, por lo que esas peticiones no necesitan validación CSRF
+		authHeader := c.GetHeader("Authorization")
+		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			tokenString = parts[1]
+			authMethod = AuthMethodBearer
+		} else if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			// Las rutas sin scopes (credenciales, 2FA, datos personales) no aceptan API keys
+			if len(scopes) == 0 {
+				c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Esta ruta no acepta API keys"})
+				c.Abort()
+				return
+			}
+			if !authenticateAPIKey(c, db, apiKey) {
+				return
 			}
+			for _, scope := range scopes {
+				if !slices.Contains(c.GetStringSlice("apiKeyScopes"), scope) {
+					c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "La API key no tiene el scope requerido"})
+					c.Abort()
+					return
+				}
+			}
+			c.Next()
+			return
+		} else if cookieToken, err := c.Cookie("access_token"); err == nil {
+			// Si no hay cabeceras, intenta obtener el token desde la cookie
+			tokenString = cookieToken
+			authMethod = AuthMethodCookie
 		}
 
 		// Si no se encontró el token en ninguno de los dos lugares, retorna error
@@ -37,41 +83,133 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Verificar el token
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de firma inválido")
-			}
-			return secret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := keys.ParseJWT(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token inválido o expirado"})
 			c.Abort()
 			return
 		}
 
+		// Evitar que tokens de verificación, reseteo o 2FA pendiente den acceso a rutas privadas
+		tokenType, _ := claims["type"].(string)
+		if !slices.Contains(allowedTypes, tokenType) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Tipo de token inválido"})
+			c.Abort()
+			return
+		}
+
 		// Extraer los datos del usuario
 		userID, userOk := claims["sub"].(float64)
-		email, emailOk := claims["email"].(string)
-		rol, rolOk := claims["rol"].(string)
-		if !userOk || !emailOk || !rolOk {
+		if !userOk {
 			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token inválido o no se encontro el usuario"})
 			c.Abort()
 			return
 		}
 
+		// El email y el rol se toman de la base de datos y no de los claims; la consulta excluye a los usuarios eliminados
+		user := new(models.Usuario)
+		err = db.NewSelect().
+			Model(user).
+			Column("id", "email", "rol").
+			Where("id = ?", int(userID)).
+			Scan(c)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Token inválido o no se encontro el usuario"})
+			} else {
+				slog.ErrorContext(c, "Error cargando el usuario del token", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error al validar la sesión"})
+			}
+			c.Abort()
+			return
+		}
+		email := user.Email
+
 		// Agregar los datos del usuario al contexto
-		c.Set("userID", int(userID))
+		c.Set("userID", user.ID)
 		c.Set("email", email)
-		c.Set("rol", rol)
+		c.Set("rol", user.Rol)
+		c.Set("tokenType", tokenType)
+		c.Set("authMethod", authMethod)
+
+		// Tokens de suplantación: el actor es el administrador que actúa como el usuario.
+		// El token deja de valer en cuanto su registro en suplantaciones se finaliza o expira,
+		// o si el administrador es eliminado o pierde el permiso users:impersonate
+		actor, impersonating := parseActor(claims)
+		if impersonating {
+			// El administrador también debe seguir activo y conservar el permiso de suplantar
+			var actorRol string
+			err := db.NewSelect().
+				Model((*models.Suplantacion)(nil)).
+				Join("JOIN usuarios AS actor ON actor.id = suplantacion.actor_id").
+				ColumnExpr("actor.rol").
+				Where("suplantacion.id = ?", actor.SessionID).
+				Where("suplantacion.actor_id = ?", actor.UserID).
+				Where("suplantacion.usuario_id = ?", user.ID).
+				Where("suplantacion.finalizada_at IS NULL").
+				Where("suplantacion.expira_at > ?", time.Now()).
+				Where("actor.deleted_at IS NULL").
+				Scan(c, &actorRol)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				slog.ErrorContext(c, "Error verificando la suplantación", "suplantacion_id", actor.SessionID, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error al validar la sesión"})
+				c.Abort()
+				return
+			}
+			if err != nil || !HasPermission(actorRol, PermUsersImpersonate) {
+				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "La suplantación finalizó o expiró"})
+				c.Abort()
+				return
+			}
+			c.Set("actor", *actor)
+			c.Set("actorID", actor.UserID)
+		}
+
+		if !passesCSRF(c, authMethod) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Token CSRF inválido o ausente"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
+
+		// Cada petición hecha en nombre de otro usuario queda registrada
+		if impersonating {
+			slog.InfoContext(c, "Petición con suplantación",
+				"suplantacion_id", actor.SessionID,
+				"actor_email", actor.Email,
+				"usuario_email", email,
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"status", c.Writer.Status())
+		}
+	}
+}
+
+// GetActor devuelve el administrador que suplanta al usuario autenticado, si la petición usa un token de suplantación
+func GetActor(c *gin.Context) (Actor, bool) {
+	actor, ok := c.Get("actor")
+	if !ok {
+		return Actor{}, false
 	}
+	a, ok := actor.(Actor)
+	return a, ok
 }
 
-// RoleMiddleware es un middleware que verifica si el usuario tiene el rol requerido
-func RoleMiddleware(requiredRole string) gin.HandlerFunc {
+// DenyImpersonation bloquea las acciones sensibles (contraseña, email, credenciales) mientras se suplanta a un usuario
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetActor(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Esta acción no está permitida mientras suplantas a un usuario"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission es un middleware que verifica si el rol del usuario otorga el permiso requerido
+func RequirePermission(permiso string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el rol del usuario del contexto (establecido por AuthMiddleware)
 		rol, exists := c.Get("rol")
@@ -81,13 +219,72 @@ func RoleMiddleware(requiredRole string) gin.HandlerFunc {
 			return
 		}
 
-		// Verificar si el rol del usuario coincide con el rol requerido
-		if rol != requiredRole {
+		// Verificar si el rol del usuario otorga el permiso
+		rolStr, _ := rol.(string)
+		if !HasPermission(rolStr, permiso) {
 			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "No tienes permisos para acceder a este recurso"})
 			c.Abort()
 			return
 		}
 
+		// Las API keys además deben incluir el permiso entre sus scopes
+		if c.GetString("authMethod") == AuthMethodAPIKey && !slices.Contains(c.GetStringSlice("apiKeyScopes"), permiso) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "La API key no tiene el scope requerido"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
+
+// authenticateAPIKey valida una API key y carga los datos de su dueño en el contexto
+func authenticateAPIKey(c *gin.Context, db *bun.DB, key string) bool {
+	prefix, ok := ParseAPIKeyPrefix(key)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "API key inválida"})
+		c.Abort()
+		return false
+	}
+
+	apiKey := new(models.APIKey)
+	err := db.NewSelect().
+		Model(apiKey).
+		Relation("Usuario").
+		Where("?TableAlias.prefijo = ?", prefix).
+		Where("?TableAlias.revocada_at IS NULL").
+		Scan(c)
+	if err != nil || apiKey.Usuario == nil || !apiKey.Usuario.DeletedAt.IsZero() ||
+		subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashAPIKey(key))) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "API key inválida"})
+		c.Abort()
+		return false
+	}
+
+	now := time.Now()
+	if apiKey.ExpiraAt != nil && now.After(*apiKey.ExpiraAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "API key expirada"})
+		c.Abort()
+		return false
+	}
+
+	// Registrar el último uso como máximo una vez por minuto para no escribir en cada petición
+	if apiKey.UltimoUsoAt == nil || now.Sub(*apiKey.UltimoUsoAt) > time.Minute {
+		_, err := db.NewUpdate().
+			Model((*models.APIKey)(nil)).
+			Set("ultimo_uso_at = ?", now).
+			Where("id = ?", apiKey.ID).
+			Exec(c)
+		if err != nil {
+			slog.ErrorContext(c, "Error actualizando último uso de API key", "api_key_id", apiKey.ID, "error", err)
+		}
+	}
+
+	c.Set("userID", apiKey.UsuarioID)
+	c.Set("email", apiKey.Usuario.Email)
+	c.Set("rol", apiKey.Usuario.Rol)
+	c.Set("authMethod", AuthMethodAPIKey)
+	c.Set("apiKeyID", apiKey.ID)
+	c.Set("apiKeyScopes", apiKey.Scopes)
+	return true
+}
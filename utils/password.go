@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+const (
+	passwordMinLength = 8
+	passwordMaxLength = 72 // bcrypt ignora los bytes posteriores
+)
+
+//go:embed data/common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords contiene la lista embebida de contraseñas comunes o filtradas
+var commonPasswords = loadCommonPasswords(commonPasswordsFile)
+
+// PasswordError describe una regla de la política de contraseñas que no se cumplió
+type PasswordError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordUser son los datos personales contra los que se compara la contraseña
+type PasswordUser struct {
+	Email    string
+	Nombre   string
+	Apellido string
+}
+
+func loadCommonPasswords(data string) map[string]struct{} {
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// ValidatePassword aplica la política de contraseñas y devuelve todas las reglas incumplidas
+func ValidatePassword(password string, user PasswordUser) []PasswordError {
+	var errs []PasswordError
+	add := func(code, message string) {
+		errs = append(errs, PasswordError{Field: "password", Code: code, Message: message})
+	}
+
+	if len([]rune(password)) < passwordMinLength {
+		add("too_short", "La contraseña debe tener al menos 8 caracteres")
+	}
+	if len(password) > passwordMaxLength {
+		add("too_long", "La contraseña no puede superar los 72 bytes")
+	}
+
+	var hasLower, hasUpper, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLower {
+		add("missing_lowercase", "La contraseña debe incluir al menos una letra minúscula")
+	}
+	if !hasUpper {
+		add("missing_uppercase", "La contraseña debe incluir al menos una letra mayúscula")
+	}
+	if !hasDigit {
+		add("missing_digit", "La contraseña debe incluir al menos un número")
+	}
+
+	lower := strings.ToLower(password)
+	if containsPersonalData(lower, user) {
+		add("personal_data", "La contraseña no puede ser igual ni contener tu email o nombre")
+	}
+
+	if _, found := commonPasswords[lower]; found {
+		add("common_password", "La contraseña es demasiado común o aparece en filtraciones conocidas")
+	}
+
+	return errs
+}
+
+// containsPersonalData indica si la contraseña coincide con el email, su parte local o el nombre
+func containsPersonalData(lowerPassword string, user PasswordUser) bool {
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	candidates := []string{email, strings.ToLower(strings.TrimSpace(user.Nombre)), strings.ToLower(strings.TrimSpace(user.Apellido))}
+	if local, _, found := strings.Cut(email, "@"); found {
+		candidates = append(candidates, local)
+	}
+
+	for _, candidate := range candidates {
+		// Se ignoran valores muy cortos para no rechazar contraseñas por coincidencias triviales
+		if len(candidate) < 3 {
+			continue
+		}
+		if strings.Contains(lowerPassword, candidate) {
+			return true
+		}
+	}
+	return false
+}
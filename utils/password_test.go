@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func passwordErrorCodes(errs []PasswordError) []string {
+	codes := make([]string, 0, len(errs))
+	for _, e := range errs {
+		codes = append(codes, e.Code)
+	}
+	return codes
+}
+
+func TestValidatePassword(t *testing.T) {
+	user := PasswordUser{Email: "juana.perez@example.com", Nombre: "Juana", Apellido: "Pérez"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"válida", "Cotizador2024", nil},
+		{"válida con caracteres no ASCII", "Ñandú2024seguro", nil},
+		{"muy corta", "Ab1cdef", []string{"too_short"}},
+		{"muy larga", "Ab1" + strings.Repeat("x", 70), []string{"too_long"}},
+		{"sin minúsculas", "COTIZADOR2024", []string{"missing_lowercase"}},
+		{"sin mayúsculas", "cotizador2024", []string{"missing_uppercase"}},
+		{"sin números", "CotizadorSeguro", []string{"missing_digit"}},
+		{"contiene el nombre", "MiJuana2024", []string{"personal_data"}},
+		{"contiene el apellido", "xPÉREZy2024a", []string{"personal_data"}},
+		{"contiene la parte local del email", "Juana.Perez99", []string{"personal_data"}},
+		{"contraseña común", "Password1", []string{"common_password"}},
+		{"vacía", "", []string{"too_short", "missing_lowercase", "missing_uppercase", "missing_digit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := passwordErrorCodes(ValidatePassword(tt.password, user))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ValidatePassword(%q) = %v, se esperaba %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordIgnoresShortPersonalData(t *testing.T) {
+	// Los datos de menos de 3 caracteres no se comparan para evitar rechazos triviales
+	user := PasswordUser{Email: "al@example.com", Nombre: "Al", Apellido: "Li"}
+	if errs := ValidatePassword("Alicia2024x", user); len(errs) != 0 {
+		t.Errorf("ValidatePassword rechazó una contraseña válida: %v", passwordErrorCodes(errs))
+	}
+}
+
+func TestValidatePasswordErrorField(t *testing.T) {
+	for _, e := range ValidatePassword("corta", PasswordUser{}) {
+		if e.Field != "password" || e.Message == "" {
+			t.Errorf("error de política incompleto: %+v", e)
+		}
+	}
+}
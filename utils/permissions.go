@@ -0,0 +1,156 @@
+package utils
+
+import "slices"
+
+// Permisos disponibles en la API
+const (
+	PermOrdersReadAll     = "orders:read_all"
+	PermOrdersUpdate      = "orders:update"
+	PermOrdersUpdateState = "orders:update_status"
+	PermProductsRead      = "products:read_all"
+	PermProductsWrite     = "products:write"
+	PermUsersRead         = "users:read"
+	PermUsersManage       = "users:manage"
+	PermUsersImpersonate  = "users:impersonate"
+	PermRolesManage       = "roles:manage"
+)
+
+// Scopes de autoservicio: cualquier usuario puede otorgarlos a sus API keys para operar sobre sus propios datos
+const (
+	ScopeProfileRead     = "profile:read"
+	ScopeProductsRead    = "products:read"
+	ScopeOrdersRead      = "orders:read"
+	ScopeOrdersCreate    = "orders:create"
+	ScopeOrdersUpdateOwn = "orders:update_own"
+	ScopeAddressesRead   = "addresses:read"
+	ScopeAddressesWrite  = "addresses:write"
+	ScopeCompaniesRead   = "companies:read"
+	ScopeCompaniesWrite  = "companies:write"
+)
+
+// Roles disponibles
+const (
+	RolAdmin        = "admin"
+	RolVendedor     = "vendedor"
+	RolBodega       = "bodega"
+	RolContabilidad = "contabilidad"
+	RolCliente      = "cliente"
+)
+
+// RoleInfo describe un rol y los permisos que otorga
+type RoleInfo struct {
+	Nombre      string   `json:"nombre"`
+	Descripcion string   `json:"descripcion"`
+	Permisos    []string `json:"permisos"`
+}
+
+// PermissionInfo describe un permiso
+type PermissionInfo struct {
+	Nombre      string `json:"nombre"`
+	Descripcion string `json:"descripcion"`
+}
+
+var permissions = []PermissionInfo{
+	{PermOrdersReadAll, "Ver todos los pedidos"},
+	{PermOrdersUpdate, "Modificar cualquier pedido y sus productos"},
+	{PermOrdersUpdateState, "Cambiar el estado y la fecha de envío de los pedidos"},
+	{PermProductsRead, "Ver el catálogo completo con precios de compra"},
+	{PermProductsWrite, "Crear, modificar y eliminar productos"},
+	{PermUsersRead, "Ver usuarios"},
+	{PermUsersManage, "Crear, modificar y eliminar usuarios"},
+	{PermUsersImpersonate, "Ver la aplicación como un cliente para darle soporte"},
+	{PermRolesManage, "Asignar roles a los usuarios"},
+}
+
+var selfServiceScopes = []PermissionInfo{
+	{ScopeProfileRead, "Ver el perfil propio"},
+	{ScopeProductsRead, "Ver el catálogo de productos para clientes"},
+	{ScopeOrdersRead, "Ver los pedidos propios"},
+	{ScopeOrdersCreate, "Crear pedidos"},
+	{ScopeOrdersUpdateOwn, "Modificar los pedidos propios pendientes"},
+	{ScopeAddressesRead, "Ver las direcciones propias"},
+	{ScopeAddressesWrite, "Crear, modificar y eliminar las direcciones propias"},
+	{ScopeCompaniesRead, "Ver las empresas propias y sus miembros"},
+	{ScopeCompaniesWrite, "Crear y modificar las empresas propias y sus miembros"},
+}
+
+var roles = []RoleInfo{
+	{
+		Nombre:      RolAdmin,
+		Descripcion: "Acceso total",
+		Permisos: []string{
+			PermOrdersReadAll, PermOrdersUpdate, PermOrdersUpdateState,
+			PermProductsRead, PermProductsWrite,
+			PermUsersRead, PermUsersManage, PermUsersImpersonate, PermRolesManage,
+		},
+	},
+	{
+		Nombre:      RolVendedor,
+		Descripcion: "Gestiona pedidos y atiende clientes",
+		Permisos:    []string{PermOrdersReadAll, PermOrdersUpdate, PermOrdersUpdateState, PermProductsRead, PermUsersRead},
+	},
+	{
+		Nombre:      RolBodega,
+		Descripcion: "Prepara y despacha pedidos",
+		Permisos:    []string{PermOrdersReadAll, PermOrdersUpdateState, PermProductsRead},
+	},
+	{
+		Nombre:      RolContabilidad,
+		Descripcion: "Consulta pedidos, productos y clientes",
+		Permisos:    []string{PermOrdersReadAll, PermProductsRead, PermUsersRead},
+	},
+	{
+		Nombre:      RolCliente,
+		Descripcion: "Cliente que cotiza y realiza pedidos",
+		Permisos:    []string{},
+	},
+}
+
+// Roles devuelve los roles definidos con sus permisos
+func Roles() []RoleInfo {
+	return roles
+}
+
+// Permissions devuelve los permisos definidos
+func Permissions() []PermissionInfo {
+	return permissions
+}
+
+// SelfServiceScopes devuelve los scopes de API key disponibles para cualquier rol
+func SelfServiceScopes() []PermissionInfo {
+	return selfServiceScopes
+}
+
+// ValidAPIKeyScope indica si un usuario con el rol puede otorgar el scope a una API key:
+// los permisos de su rol y los scopes de autoservicio
+func ValidAPIKeyScope(rol, scope string) bool {
+	if HasPermission(rol, scope) {
+		return true
+	}
+	for _, s := range selfServiceScopes {
+		if s.Nombre == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole indica si el rol existe
+func ValidRole(rol string) bool {
+	for _, r := range roles {
+		if r.Nombre == rol {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission indica si el rol otorga el permiso
+func HasPermission(rol, permiso string) bool {
+	for _, r := range roles {
+		if r.Nombre == rol {
+			return slices.Contains(r.Permisos, permiso)
+		}
+	}
+	return false
+}
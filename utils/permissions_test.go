@@ -0,0 +1,103 @@
+package utils
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		rol     string
+		permiso string
+		want    bool
+	}{
+		{RolAdmin, PermOrdersReadAll, true},
+		{RolAdmin, PermOrdersUpdate, true},
+		{RolAdmin, PermOrdersUpdateState, true},
+		{RolAdmin, PermProductsRead, true},
+		{RolAdmin, PermProductsWrite, true},
+		{RolAdmin, PermUsersRead, true},
+		{RolAdmin, PermUsersManage, true},
+		{RolAdmin, PermUsersImpersonate, true},
+		{RolAdmin, PermRolesManage, true},
+
+		{RolVendedor, PermOrdersReadAll, true},
+		{RolVendedor, PermOrdersUpdate, true},
+		{RolVendedor, PermOrdersUpdateState, true},
+		{RolVendedor, PermProductsRead, true},
+		{RolVendedor, PermUsersRead, true},
+		{RolVendedor, PermProductsWrite, false},
+		{RolVendedor, PermUsersManage, false},
+		{RolVendedor, PermUsersImpersonate, false},
+		{RolVendedor, PermRolesManage, false},
+
+		{RolBodega, PermOrdersReadAll, true},
+		{RolBodega, PermOrdersUpdateState, true},
+		{RolBodega, PermProductsRead, true},
+		{RolBodega, PermOrdersUpdate, false},
+		{RolBodega, PermUsersRead, false},
+
+		{RolContabilidad, PermOrdersReadAll, true},
+		{RolContabilidad, PermProductsRead, true},
+		{RolContabilidad, PermUsersRead, true},
+		{RolContabilidad, PermOrdersUpdate, false},
+		{RolContabilidad, PermOrdersUpdateState, false},
+
+		{RolCliente, PermOrdersReadAll, false},
+		{RolCliente, PermProductsRead, false},
+		{RolCliente, PermUsersImpersonate, false},
+
+		// Los scopes de autoservicio no son permisos de ningún rol
+		{RolAdmin, ScopeOrdersCreate, false},
+		{"inexistente", PermOrdersReadAll, false},
+		{"", PermOrdersReadAll, false},
+	}
+	for _, tt := range tests {
+		if got := HasPermission(tt.rol, tt.permiso); got != tt.want {
+			t.Errorf("HasPermission(%q, %q) = %v, se esperaba %v", tt.rol, tt.permiso, got, tt.want)
+		}
+	}
+}
+
+func TestRolesOnlyUseDefinedPermissions(t *testing.T) {
+	defined := make(map[string]bool)
+	for _, p := range Permissions() {
+		defined[p.Nombre] = true
+	}
+	for _, r := range Roles() {
+		if !ValidRole(r.Nombre) {
+			t.Errorf("ValidRole(%q) = false para un rol definido", r.Nombre)
+		}
+		for _, p := range r.Permisos {
+			if !defined[p] {
+				t.Errorf("el rol %q otorga el permiso no definido %q", r.Nombre, p)
+			}
+		}
+	}
+	if ValidRole("superadmin") {
+		t.Error("ValidRole aceptó un rol inexistente")
+	}
+}
+
+func TestValidAPIKeyScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		rol   string
+		scope string
+		want  bool
+	}{
+		{"autoservicio para cliente", RolCliente, ScopeOrdersCreate, true},
+		{"autoservicio para admin", RolAdmin, ScopeAddressesWrite, true},
+		{"permiso propio del rol", RolVendedor, PermOrdersReadAll, true},
+		{"permiso de admin para admin", RolAdmin, PermUsersManage, true},
+		{"permiso ajeno al rol", RolCliente, PermOrdersReadAll, false},
+		{"permiso de admin para vendedor", RolVendedor, PermRolesManage, false},
+		{"scope inexistente", RolAdmin, "orders:delete", false},
+		{"rol inexistente con permiso", "inexistente", PermOrdersReadAll, false},
+		{"vacío", RolCliente, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidAPIKeyScope(tt.rol, tt.scope); got != tt.want {
+				t.Errorf("ValidAPIKeyScope(%q, %q) = %v, se esperaba %v", tt.rol, tt.scope, got, tt.want)
+			}
+		})
+	}
+}
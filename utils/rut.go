@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NormalizeRUT quita puntos y espacios y deja el RUT con formato 12345678-K
+func NormalizeRUT(rut string) string {
+	rut = strings.ToUpper(strings.TrimSpace(rut))
+	rut = strings.ReplaceAll(rut, ".", "")
+	rut = strings.ReplaceAll(rut, " ", "")
+	rut = strings.ReplaceAll(rut, "-", "")
+	if len(rut) < 2 {
+		return rut
+	}
+	return rut[:len(rut)-1] + "-" + rut[len(rut)-1:]
+}
+
+// ValidRUT verifica el dígito verificador de un RUT chileno (módulo 11)
+func ValidRUT(rut string) bool {
+	cuerpo, dv, found := strings.Cut(NormalizeRUT(rut), "-")
+	if !found || len(cuerpo) < 7 || len(cuerpo) > 8 || len(dv) != 1 {
+		return false
+	}
+	numero, err := strconv.Atoi(cuerpo)
+	if err != nil || numero <= 0 {
+		return false
+	}
+
+	suma, multiplicador := 0, 2
+	for numero > 0 {
+		suma += (numero % 10) * multiplicador
+		numero /= 10
+		multiplicador++
+		if multiplicador > 7 {
+			multiplicador = 2
+		}
+	}
+
+	esperado := 11 - suma%11
+	switch esperado {
+	case 11:
+		return dv == "0"
+	case 10:
+		return dv == "K"
+	default:
+		return dv == strconv.Itoa(esperado)
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import "testing"
+
+func TestNormalizeRUT(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"12.345.678-5", "12345678-5"},
+		{"12345678-5", "12345678-5"},
+		{"123456785", "12345678-5"},
+		{" 10.000.013-k ", "10000013-K"},
+		{"7 654 321 6", "7654321-6"},
+		{"1", "1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRUT(tt.in); got != tt.want {
+			t.Errorf("NormalizeRUT(%q) = %q, se esperaba %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidRUT(t *testing.T) {
+	tests := []struct {
+		rut   string
+		valid bool
+	}{
+		// Dígito verificador numérico, K (resto 10) y 0 (resto 11)
+		{"11.111.111-1", true},
+		{"12.345.678-5", true},
+		{"7.654.321-6", true},
+		{"10.000.013-K", true},
+		{"10000013-k", true},
+		{"10.000.004-0", true},
+		{"1.000.000-9", true},
+
+		// Dígito verificador incorrecto
+		{"12.345.678-4", false},
+		{"10.000.013-0", false},
+		{"10.000.004-K", false},
+
+		// Formato inválido
+		{"", false},
+		{"5", false},
+		{"123456-0", false},
+		{"123.456.789-2", false},
+		{"12.345.67A-5", false},
+		{"12.345.678-55", false},
+		{"00.000.000-0", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRUT(tt.rut); got != tt.valid {
+			t.Errorf("ValidRUT(%q) = %v, se esperaba %v", tt.rut, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret es la clave SHA1 del Apéndice B de RFC 6238 ("12345678901234567890") codificada en base32
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// Vectores SHA1 del Apéndice B de RFC 6238; los códigos son los 6 últimos dígitos de los de 8 dígitos
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfc6238Vectors {
+		if got := totpCode(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("totpCode(T=%d) = %s, se esperaba %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, 0, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(T=%d, %s) rechazó un código válido", v.unix, v.code)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(T=%d) devolvió el paso %d, se esperaba %d", v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		offset int64
+		valid  bool
+	}{
+		{"paso actual", 0, true},
+		{"un paso atrás", -1, true},
+		{"un paso adelante", 1, true},
+		{"dos pasos atrás", -2, false},
+		{"dos pasos adelante", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := totpCode(key, current+tt.offset)
+			step, ok := ValidateTOTP(rfc6238Secret, code, 0, now)
+			if ok != tt.valid {
+				t.Fatalf("ValidateTOTP = %v, se esperaba %v", ok, tt.valid)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("ValidateTOTP devolvió el paso %d, se esperaba %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsReuse(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := ValidateTOTP(rfc6238Secret, "050471", 0, now)
+	if !ok {
+		t.Fatal("ValidateTOTP rechazó un código válido")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "050471", step, now); ok {
+		t.Error("ValidateTOTP aceptó un código ya usado")
+	}
+
+	// Un código del paso anterior tampoco sirve si ya se usó uno posterior
+	previous := totpCode([]byte("12345678901234567890"), step-1)
+	if _, ok := ValidateTOTP(rfc6238Secret, previous, step, now); ok {
+		t.Error("ValidateTOTP aceptó un código anterior al último usado")
+	}
+}
+
+func TestValidateTOTPInvalidInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"código corto", rfc6238Secret, "05047"},
+		{"código largo", rfc6238Secret, "0504710"},
+		{"código incorrecto", rfc6238Secret, "000000"},
+		{"secreto inválido", "no-es-base32!", "050471"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, 0, now); ok {
+				t.Errorf("ValidateTOTP(%q, %q) = true, se esperaba false", tt.secret, tt.code)
+			}
+		})
+	}
+
+	// Los espacios alrededor del código y el secreto en minúsculas se aceptan
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 050471 ", 0, now); !ok {
+		t.Error("ValidateTOTP rechazó un código con espacios o un secreto en minúsculas")
+	}
+}
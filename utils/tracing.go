@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"cotizador-productos-eml/config"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifica los spans creados directamente por la aplicación
+const tracerName = "cotizador-productos-eml"
+
+// tracer crea los spans propios de la aplicación. Mientras el tracing esté desactivado usa el proveedor no-op
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupTracing registra el TracerProvider global con un exportador OTLP/HTTP. Si el tracing está desactivado
+// no hace nada y los spans no se registran. La función devuelta envía los spans pendientes al apagar
+func SetupTracing(ctx context.Context, cfg config.TracingConfig, environment string) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creando el exportador OTLP: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.DeploymentEnvironment(environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error creando el recurso de OpenTelemetry: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Error de OpenTelemetry", "error", err)
+	}))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}